@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+	"war-ticket-engine/services"
+)
+
+// backupCommand writes a consistent copy of the store to a file. It is
+// safe to run next to the server.
+func backupCommand(args []string) int {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := flags.String("o", "", "backup file (default backup-YYYYMMDD-HHMMSS.json)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	backup, err := services.TakeBackup()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+		return 1
+	}
+	path := *out
+	if path == "" {
+		path = backup.CreatedAt.Format("backup-20060102-150405.json")
+	}
+	if err := backup.WriteFile(path); err != nil {
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Backed up %d users, %d tickets and %d locations to %s\n",
+		len(backup.Users), len(backup.Tickets), len(backup.Locations), path)
+	return 0
+}
+
+// restoreCommand replaces the data of the configured store, JSON or
+// Postgres, with a backup taken from either, and resets the Redis
+// counters to match it. Stop the server first: a running JSON store
+// would keep writing its own copy of the data.
+func restoreCommand(args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	force := flags.Bool("force", false, "replace a store that already has users or tickets")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: engine restore [-force] <backup file>")
+		return 2
+	}
+
+	backup, err := services.ReadBackup(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read backup: %v\n", err)
+		return 1
+	}
+	store, err := services.OpenStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open store: %v\n", err)
+		return 1
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "close store: %v\n", err)
+		}
+	}()
+
+	current, err := store.Backup()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return 1
+	}
+	if !*force && len(current.Users)+len(current.Tickets) > 0 {
+		fmt.Fprintf(os.Stderr, "store already has %d users and %d tickets; use -force to replace them\n",
+			len(current.Users), len(current.Tickets))
+		return 1
+	}
+	if err := store.Restore(backup); err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return 1
+	}
+	if err := services.ResetCounters(store); err != nil {
+		fmt.Fprintf(os.Stderr, "restore: data restored, but resetting the Redis counters failed (start the server and let the reconciler repair them): %v\n", err)
+		return 1
+	}
+	fmt.Printf("Restored %d users, %d tickets and %d locations from the %s backup of %s\n",
+		len(backup.Users), len(backup.Tickets), len(backup.Locations), backup.Backend,
+		backup.CreatedAt.Local().Format(time.DateTime))
+	return 0
+}
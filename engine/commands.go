@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: engine [command]
+
+Without a command the server starts. Commands:
+  migrate [-dry-run | -report]   apply, preview or list store migrations
+  backup [-o file]               copy the store to a file, safe while serving
+  restore [-force] <file>        replace the store's data with a backup
+  export [flags] tickets|users   write CSV or JSON Lines (export -h for flags)
+`
+
+// runCommand runs a maintenance command instead of the server and
+// returns the process exit code.
+func runCommand(name string, args []string) int {
+	switch name {
+	case "migrate":
+		return migrateCommand(args)
+	case "backup":
+		return backupCommand(args)
+	case "restore":
+		return restoreCommand(args)
+	case "export":
+		return exportCommand(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, usage)
+		return 2
+	}
+}
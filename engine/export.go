@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"war-ticket-engine/models"
+	"war-ticket-engine/services"
+)
+
+var ticketExportColumns = []string{
+	"id", "ticket_number", "code", "status", "location_id", "location_name", "date", "time_slot",
+	"user_id", "holder_name", "holder_nik", "holder_whatsapp",
+	"created_at", "cancelled_at", "cancelled_by", "redeemed_at", "redeemed_by", "no_show_at", "no_show_by", "expired_at",
+}
+
+// Password hashes are deliberately left out.
+var userExportColumns = []string{"id", "nik", "nama", "whatsapp", "email", "role", "location_id", "created_at"}
+
+// exportCommand writes tickets or users as CSV or JSON Lines, from the
+// live store (read as for a backup) or from a backup file. Tickets can
+// be narrowed to one boutique, date and status.
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	from := flags.String("from", "", "backup file to export from instead of the store")
+	format := flags.String("format", "csv", "csv or jsonl")
+	out := flags.String("o", "", "output file (default standard output)")
+	location := flags.String("location", "", "only tickets for this location ID")
+	date := flags.String("date", "", "only tickets for this visit date (YYYY-MM-DD)")
+	status := flags.String("status", "", "only tickets with this status")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	what := flags.Arg(0)
+	if flags.NArg() != 1 || (what != "tickets" && what != "users") || (*format != "csv" && *format != "jsonl") {
+		fmt.Fprintln(os.Stderr, "usage: engine export [-format csv|jsonl] [-from backup] [-o file] tickets|users")
+		return 2
+	}
+
+	var backup services.Backup
+	var err error
+	if *from != "" {
+		backup, err = services.ReadBackup(*from)
+	} else {
+		backup, err = services.TakeBackup()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+
+	var columns []string
+	var rows [][]string
+	if what == "users" {
+		columns = userExportColumns
+		for _, user := range backup.Users {
+			rows = append(rows, userExportRow(user))
+		}
+	} else {
+		columns = ticketExportColumns
+		holders := make(map[string]models.User, len(backup.Users))
+		for _, user := range backup.Users {
+			holders[user.ID] = user
+		}
+		for _, ticket := range backup.Tickets {
+			if (*location != "" && ticket.LocationID != *location) ||
+				(*date != "" && ticket.Date != *date) ||
+				(*status != "" && ticket.CurrentStatus() != *status) {
+				continue
+			}
+			rows = append(rows, ticketExportRow(ticket, holders[ticket.UserID]))
+		}
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "export: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "csv" {
+		err = writeCSV(w, columns, rows)
+	} else {
+		err = writeJSONLines(w, columns, rows)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d %s to %s\n", len(rows), what, *out)
+	}
+	return 0
+}
+
+func ticketExportRow(t models.Ticket, holder models.User) []string {
+	return []string{
+		t.ID, t.TicketNumber, t.Code, t.CurrentStatus(), t.LocationID, t.LocationName, t.Date, t.TimeSlot,
+		t.UserID, holder.Nama, holder.NIK, holder.Whatsapp,
+		exportTime(&t.CreatedAt), exportTime(t.CancelledAt), t.CancelledBy, exportTime(t.RedeemedAt), t.RedeemedBy,
+		exportTime(t.NoShowAt), t.NoShowBy, exportTime(t.ExpiredAt),
+	}
+}
+
+func userExportRow(u models.User) []string {
+	role := u.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+	return []string{u.ID, u.NIK, u.Nama, u.Whatsapp, u.Email, role, u.LocationID, exportTime(&u.CreatedAt)}
+}
+
+func exportTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func writeCSV(w io.Writer, columns []string, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	return cw.WriteAll(rows)
+}
+
+// writeJSONLines writes one object per row with the keys in column
+// order.
+func writeJSONLines(w io.Writer, columns []string, rows [][]string) error {
+	bw := bufio.NewWriter(w)
+	for _, row := range rows {
+		bw.WriteByte('{')
+		for i, column := range columns {
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			key, _ := json.Marshal(column)
+			value, _ := json.Marshal(row[i])
+			bw.Write(key)
+			bw.WriteByte(':')
+			bw.Write(value)
+		}
+		bw.WriteString("}\n")
+	}
+	return bw.Flush()
+}
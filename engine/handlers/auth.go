@@ -109,7 +109,7 @@ func sanitizeName(name string) string {
 	return strings.TrimSpace(clean)
 }
 
-func RegisterHandler(captcha *services.CaptchaService) gin.HandlerFunc {
+func RegisterHandler(store services.Store, captcha *services.CaptchaService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req RegisterRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -140,11 +140,11 @@ func RegisterHandler(captcha *services.CaptchaService) gin.HandlerFunc {
 		}
 
 		// Check existing user
-		if _, exists := services.DB.GetUserByNIK(req.NIK); exists {
+		if _, exists := store.GetUserByNIK(req.NIK); exists {
 			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "NIK sudah terdaftar"})
 			return
 		}
-		if _, exists := services.DB.GetUserByEmailOrPhone(req.Email); exists {
+		if _, exists := store.GetUserByEmailOrPhone(req.Email); exists {
 			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "Email sudah terdaftar"})
 			return
 		}
@@ -159,10 +159,26 @@ func RegisterHandler(captcha *services.CaptchaService) gin.HandlerFunc {
 			Whatsapp:  req.Whatsapp,
 			Email:     req.Email,
 			Password:  string(hashedPassword),
+			Role:      models.RoleUser,
 			CreatedAt: time.Now(),
 		}
 
-		services.DB.SetUser(user)
+		// The checks above give friendly answers; the store still rejects
+		// a duplicate registered concurrently.
+		switch err := store.SetUser(user); {
+		case errors.Is(err, services.ErrDuplicateNIK):
+			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "NIK sudah terdaftar"})
+			return
+		case errors.Is(err, services.ErrDuplicateEmail):
+			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "Email sudah terdaftar"})
+			return
+		case errors.Is(err, services.ErrDuplicateWhatsapp):
+			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "Nomor WhatsApp sudah terdaftar"})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal menyimpan pengguna"})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "success",
@@ -178,7 +194,7 @@ func RegisterHandler(captcha *services.CaptchaService) gin.HandlerFunc {
 	}
 }
 
-func LoginHandler(captcha *services.CaptchaService) gin.HandlerFunc {
+func LoginHandler(store services.Store, captcha *services.CaptchaService, sessions *services.SessionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req LoginRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -202,7 +218,7 @@ func LoginHandler(captcha *services.CaptchaService) gin.HandlerFunc {
 			}
 		}
 
-		user, exists := services.DB.GetUserByEmailOrPhone(req.Identifier)
+		user, exists := store.GetUserByEmailOrPhone(req.Identifier)
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "User tidak ditemukan"})
 			return
@@ -213,9 +229,16 @@ func LoginHandler(captcha *services.CaptchaService) gin.HandlerFunc {
 			return
 		}
 
+		tokens, err := sessions.Issue(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal membuat sesi"})
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "success",
 			"message": "Login berhasil",
+			"session": tokens,
 			"user": gin.H{
 				"id":       user.ID,
 				"nik":      user.NIK,
@@ -226,3 +249,43 @@ func LoginHandler(captcha *services.CaptchaService) gin.HandlerFunc {
 		})
 	}
 }
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func RefreshSessionHandler(sessions *services.SessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RefreshRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request"})
+			return
+		}
+
+		tokens, err := sessions.Refresh(req.RefreshToken)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Sesi tidak valid atau sudah berakhir"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "session": tokens})
+	}
+}
+
+func LogoutHandler(sessions *services.SessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c.GetHeader("Authorization"))
+		if token == "" {
+			var req RefreshRequest
+			_ = c.ShouldBindJSON(&req)
+			token = req.RefreshToken
+		}
+
+		if err := sessions.Revoke(token); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Sesi tidak valid"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Logout berhasil"})
+	}
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"war-ticket-engine/models"
+	"war-ticket-engine/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LocationID in these requests is only read for admins without an
+// assigned boutique; staff always act for the boutique they work at.
+type CheckInRequest struct {
+	Payload    string `json:"payload"`
+	LocationID string `json:"location_id"`
+}
+
+type NoShowRequest struct {
+	LocationID string `json:"location_id"`
+}
+
+var (
+	errPassMismatch = errors.New("pass does not match ticket")
+	errWrongSlot    = errors.New("outside ticket time slot")
+)
+
+// CheckInHandler redeems a scanned ticket pass at the staff member's
+// assigned boutique. The pass must be authentic and unexpired, belong to that
+// location (war tickets are valid at any boutique) and be scanned on its
+// date from CHECKIN_EARLY_MINUTES (default 30) before its slot starts.
+// The ticket is marked redeemed under the database lock, so a pass can
+// only be redeemed once; replays get 409 with who redeemed it and when.
+func CheckInHandler(store services.Store, writer *services.TicketWriter, passes *services.TicketPassService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CheckInRequest
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Payload) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Payload wajib diisi"})
+			return
+		}
+		locationID, ok := staffLocation(c, req.LocationID)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		pass, err := passes.Verify(req.Payload, now)
+		switch {
+		case errors.Is(err, services.ErrPassExpired):
+			c.JSON(http.StatusGone, gin.H{"status": "failed", "code": "pass_expired", "message": "Tiket sudah kedaluwarsa"})
+			return
+		case err != nil:
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "code": "pass_invalid", "message": "QR tiket tidak valid"})
+			return
+		}
+
+		if pass.LocationID != services.WarQuotaID && pass.LocationID != locationID {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":      "failed",
+				"code":        "wrong_location",
+				"message":     "Tiket ini untuk butik lain",
+				"location_id": pass.LocationID,
+			})
+			return
+		}
+
+		if _, queued := writer.Pending(pass.TicketID); queued {
+			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "Tiket masih diproses, coba lagi sebentar"})
+			return
+		}
+
+		early := time.Duration(readNonNegativeInt("CHECKIN_EARLY_MINUTES", 30)) * time.Minute
+		staff := currentUser(c)
+		var previous models.Ticket
+		ticket, err := store.UpdateTicket(pass.TicketID, func(t *models.Ticket) error {
+			previous = *t
+			if t.Code != pass.Code || t.LocationID != pass.LocationID || t.Date != pass.Date || t.TimeSlot != pass.TimeSlot {
+				return errPassMismatch
+			}
+			if t.CurrentStatus() == models.TicketRedeemed {
+				return services.ErrTicketRedeemed
+			}
+			if !t.CanTransition(models.TicketRedeemed) {
+				return models.ErrInvalidTransition
+			}
+			opens, err := checkInOpens(*t, early)
+			if err != nil {
+				return err
+			}
+			if now.Before(opens) {
+				return errWrongSlot
+			}
+			return t.Transition(models.TicketRedeemed, now, staff.ID)
+		})
+		switch {
+		case err == nil:
+		case errors.Is(err, services.ErrNotFound), errors.Is(err, errPassMismatch):
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "code": "pass_invalid", "message": "QR tiket tidak valid"})
+			return
+		case errors.Is(err, services.ErrTicketRedeemed):
+			c.JSON(http.StatusConflict, gin.H{
+				"status":      "failed",
+				"code":        "already_redeemed",
+				"message":     "Tiket sudah digunakan",
+				"redeemed_at": previous.RedeemedAt,
+				"redeemed_by": previous.RedeemedBy,
+			})
+			return
+		case errors.Is(err, models.ErrInvalidTransition):
+			c.JSON(http.StatusConflict, gin.H{
+				"status":        "failed",
+				"code":          "ticket_not_active",
+				"message":       "Tiket sudah tidak aktif",
+				"ticket_status": previous.CurrentStatus(),
+			})
+			return
+		case errors.Is(err, errWrongSlot):
+			c.JSON(http.StatusConflict, gin.H{
+				"status":    "failed",
+				"code":      "wrong_slot",
+				"message":   "Belum waktunya kunjungan untuk tiket ini",
+				"date":      pass.Date,
+				"time_slot": pass.TimeSlot,
+			})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal memproses check-in"})
+			return
+		}
+
+		log.Printf("ticket %s redeemed at %s by %s", ticket.ID, locationID, staff.ID)
+		holder, _ := store.GetUser(ticket.UserID)
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "Check-in berhasil",
+			"ticket":  ticket,
+			"holder":  holder.Nama,
+		})
+	}
+}
+
+// MarkNoShowHandler lets staff assigned to the ticket's boutique record
+// that its holder did not turn up, once the time slot has started.
+func MarkNoShowHandler(store services.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req NoShowRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request"})
+			return
+		}
+		locationID, ok := staffLocation(c, req.LocationID)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		staff := currentUser(c)
+		var current string
+		ticket, err := store.UpdateTicket(c.Param("id"), func(t *models.Ticket) error {
+			if t.LocationID != locationID {
+				return services.ErrNotFound
+			}
+			current = t.CurrentStatus()
+			if !t.CanTransition(models.TicketNoShow) {
+				return models.ErrInvalidTransition
+			}
+			starts, err := checkInOpens(*t, 0)
+			if err != nil {
+				return err
+			}
+			if now.Before(starts) {
+				return errWrongSlot
+			}
+			return t.Transition(models.TicketNoShow, now, staff.ID)
+		})
+		switch {
+		case err == nil:
+		case errors.Is(err, services.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Tiket tidak ditemukan"})
+			return
+		case errors.Is(err, models.ErrInvalidTransition):
+			c.JSON(http.StatusConflict, gin.H{
+				"status":        "failed",
+				"code":          "ticket_not_active",
+				"message":       "Tiket sudah tidak aktif",
+				"ticket_status": current,
+			})
+			return
+		case errors.Is(err, errWrongSlot):
+			c.JSON(http.StatusConflict, gin.H{"status": "failed", "code": "wrong_slot", "message": "Slot waktu tiket ini belum dimulai"})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal memperbarui tiket"})
+			return
+		}
+
+		log.Printf("ticket %s marked no-show at %s by %s", ticket.ID, locationID, staff.ID)
+		c.JSON(http.StatusOK, gin.H{"status": "success", "ticket": ticket})
+	}
+}
+
+// staffLocation returns the boutique the caller acts for: the one they
+// are assigned to, or for an admin without one the requested location.
+// It writes the error response itself when there is none.
+func staffLocation(c *gin.Context, requested string) (string, bool) {
+	staff := currentUser(c)
+	admin := c.GetString(ctxRoleKey) == models.RoleAdmin
+	switch {
+	case staff.LocationID != "":
+		if requested != "" && requested != staff.LocationID {
+			c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "Anda tidak bertugas di butik ini"})
+			return "", false
+		}
+		return staff.LocationID, true
+	case admin && requested != "":
+		return requested, true
+	case admin:
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Lokasi wajib diisi"})
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "Akun staf belum ditugaskan ke butik"})
+	}
+	return "", false
+}
+
+// checkInOpens is the earliest moment a ticket can be redeemed: early
+// before its slot starts, or the start of its date without a slot.
+func checkInOpens(ticket models.Ticket, early time.Duration) (time.Time, error) {
+	if ticket.TimeSlot == "" {
+		return time.ParseInLocation(dateLayout, ticket.Date, time.Local)
+	}
+	start, err := time.ParseInLocation(dateLayout+" "+slotLayout, ticket.Date+" "+ticket.TimeSlot, time.Local)
+	return start.Add(-early), err
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"war-ticket-engine/services"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sseHeartbeat = 15 * time.Second
+	sseRetryMs   = 3000
+)
+
+// EventsHandler streams live quota, gate and waiting room updates as
+// Server-Sent Events. Clients resume with the Last-Event-ID header (or
+// last_event_id query parameter) and may pass queue_token to receive
+// their own queue position instead of the raw admission cursor.
+func EventsHandler(redis *services.RedisService, queue *services.QueueService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lastID := parseLastEventID(c)
+		queueNumber := int64(-1)
+		if token := strings.TrimSpace(c.Query("queue_token")); token != "" {
+			number, err := queue.Number(token)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Token antrean tidak valid"})
+				return
+			}
+			queueNumber = number
+		}
+
+		events, backlog, cancel := redis.Events.Subscribe(lastID)
+		defer cancel()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.WriteString("retry: " + strconv.Itoa(sseRetryMs) + "\n\n")
+
+		if queueNumber >= 0 {
+			if status, err := queue.Position(queueNumber); err == nil {
+				writeQueuePosition(c, 0, status)
+			}
+		}
+		for _, event := range backlog {
+			writeEvent(c, queue, queueNumber, event)
+		}
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(sseHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case event := <-events:
+				writeEvent(c, queue, queueNumber, event)
+			case <-heartbeat.C:
+				c.Writer.WriteString(": heartbeat\n\n")
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+func writeEvent(c *gin.Context, queue *services.QueueService, queueNumber int64, event services.Event) {
+	if event.Type == services.EventQueue {
+		if queueNumber < 0 {
+			return
+		}
+		var update services.QueueEvent
+		if err := json.Unmarshal(event.Data, &update); err != nil {
+			return
+		}
+		status, _ := queue.Position(queueNumber)
+		status.Position = max(queueNumber-update.Admitted, 0)
+		status.Admitted = queueNumber <= update.Admitted
+		writeQueuePosition(c, event.ID, status)
+		return
+	}
+
+	c.Render(-1, sse.Event{
+		Id:    strconv.FormatInt(event.ID, 10),
+		Event: event.Type,
+		Data:  string(event.Data),
+	})
+}
+
+func writeQueuePosition(c *gin.Context, id int64, status services.QueueTicket) {
+	event := sse.Event{
+		Event: "queue_position",
+		Data: gin.H{
+			"number":   status.Number,
+			"position": status.Position,
+			"admitted": status.Admitted,
+		},
+	}
+	if id > 0 {
+		event.Id = strconv.FormatInt(id, 10)
+	}
+	c.Render(-1, event)
+}
+
+func parseLastEventID(c *gin.Context) int64 {
+	raw := strings.TrimSpace(c.GetHeader("Last-Event-ID"))
+	if raw == "" {
+		raw = strings.TrimSpace(c.Query("last_event_id"))
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
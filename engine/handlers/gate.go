@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"war-ticket-engine/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ctxGateBypassKey marks a request that passed the gate on a QA/audit
+// bypass token rather than the schedule.
+const ctxGateBypassKey = "gate_bypass"
+
+// gateAllows runs the regular (or pre-open) gate check for the location
+// at the current time and writes the rejection response itself when it
+// fails. A closed gate can be passed with a bypass token in the
+// X-Gate-Bypass header; every such attempt is audit-logged.
+func gateAllows(c *gin.Context, gate *services.GateService, locationID string, preOpen bool) bool {
+	check := gate.Check
+	if preOpen {
+		check = gate.CheckPreOpen
+	}
+	now := time.Now()
+	status, err := check(locationID, now)
+	if err == nil {
+		return true
+	}
+
+	if token := strings.TrimSpace(c.GetHeader("X-Gate-Bypass")); token != "" {
+		grant, bypassErr := gate.Bypass(token, locationID, now, services.AuditEntry{
+			Actor: currentUser(c).ID,
+			IP:    c.ClientIP(),
+			Path:  c.Request.Method + " " + c.FullPath(),
+		})
+		if bypassErr != nil {
+			c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "Token bypass tidak valid"})
+			return false
+		}
+		c.Set(ctxGateBypassKey, grant)
+		return true
+	}
+
+	switch {
+	case errors.Is(err, services.ErrGateNotOpen):
+		c.JSON(http.StatusTooEarly, gin.H{
+			"status":   "error",
+			"message":  "Pemesanan belum dibuka",
+			"gate":     status,
+			"opens_at": status.OpensAt,
+		})
+	case errors.Is(err, services.ErrPreOpenEnded):
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "Pre-open sudah berakhir", "gate": status})
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "Pemesanan sudah ditutup", "gate": status})
+	}
+	return false
+}
+
+func GateStatusHandler(gate *services.GateService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locationID := strings.TrimSpace(c.Query("location_id"))
+		if locationID == "" {
+			locationID = services.WarQuotaID
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success", "gate": gate.Status(locationID, time.Now())})
+	}
+}
+
+type IssueGateBypassRequest struct {
+	LocationIDs []string  `json:"location_ids"`
+	ValidFrom   time.Time `json:"valid_from"`
+	ValidUntil  time.Time `json:"valid_until"`
+	Note        string    `json:"note"`
+}
+
+// AdminIssueGateBypassHandler hands out a QA/audit bypass token scoped to
+// the given locations (use "war" for the war gate). valid_from defaults
+// to now.
+func AdminIssueGateBypassHandler(store services.Store, bypass *services.BypassService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req IssueGateBypassRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request"})
+			return
+		}
+		for _, id := range req.LocationIDs {
+			if _, exists := store.GetLocation(id); !exists && id != services.WarQuotaID {
+				c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Lokasi tidak ditemukan: " + id})
+				return
+			}
+		}
+		if req.ValidFrom.IsZero() {
+			req.ValidFrom = time.Now()
+		}
+
+		admin := currentUser(c)
+		grant, token, err := bypass.Issue(admin.ID, req.LocationIDs, req.ValidFrom, req.ValidUntil, strings.TrimSpace(req.Note))
+		switch {
+		case errors.Is(err, services.ErrBypassNoTarget):
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Pilih minimal satu lokasi"})
+			return
+		case errors.Is(err, services.ErrBypassTooLong):
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Masa berlaku token tidak valid atau terlalu panjang"})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal membuat token bypass"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "token": token, "bypass": grant})
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"war-ticket-engine/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// responseRecorder keeps a copy of everything the handler writes so it
+// can be stored for replay.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotent honours the Idempotency-Key header: the first request with a
+// key runs normally and its response is stored; retries with the same key
+// by the same user get that response replayed (with an
+// Idempotent-Replayed header) instead of running the handler again.
+// Only successes and deterministic client errors are stored; server
+// errors and answers that depend on the moment (a conflict, "not your
+// turn yet", rate limits, a "failed" result such as sold out) or on
+// headers outside the fingerprint (401/403 from the session, queue or
+// bypass token) release the key so the retry runs for real.
+// Requests without the header are unaffected. It must run after
+// AuthMiddleware.
+func Idempotent(idempotency *services.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Idempotency-Key terlalu panjang"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+		scopedKey := currentUser(c).ID + ":" + c.Request.Method + ":" + c.FullPath() + ":" + key
+
+		stored, err := idempotency.Begin(scopedKey, fingerprint)
+		switch {
+		case errors.Is(err, services.ErrIdempotencyInFlight):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"status": "error", "message": "Permintaan yang sama masih diproses"})
+			return
+		case errors.Is(err, services.ErrIdempotencyMismatch):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"status": "error", "message": "Idempotency-Key sudah dipakai untuk permintaan lain"})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Idempotency error"})
+			return
+		case stored != nil:
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(stored.Status, stored.ContentType, stored.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if !replayable(status, recorder.body.Bytes()) {
+			if err := idempotency.Release(scopedKey); err != nil {
+				log.Printf("idempotency release failed: %v", err)
+			}
+			return
+		}
+		err = idempotency.Complete(scopedKey, fingerprint, services.StoredResponse{
+			Status:      status,
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+		})
+		if err != nil {
+			log.Printf("idempotency store failed: %v", err)
+		}
+	}
+}
+
+// replayable reports whether a response may be replayed to a retry.
+func replayable(status int, body []byte) bool {
+	switch {
+	case status >= 200 && status < 300:
+		// A "failed" body (sold out, slot full) is only true right now.
+		var result struct {
+			Status string `json:"status"`
+		}
+		return json.Unmarshal(body, &result) != nil || result.Status != "failed"
+	case status == http.StatusUnauthorized,
+		status == http.StatusForbidden,
+		status == http.StatusRequestTimeout,
+		status == http.StatusConflict,
+		status == http.StatusLocked,
+		status == http.StatusTooEarly,
+		status == http.StatusTooManyRequests:
+		return false
+	default:
+		return status >= 400 && status < 500
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"war-ticket-engine/models"
+	"war-ticket-engine/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotentReplaysOnlyFinalResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		status int
+		replay bool
+	}{
+		{"created", http.StatusCreated, true},
+		{"ok", http.StatusOK, true},
+		{"validation error", http.StatusBadRequest, true},
+		{"not found", http.StatusNotFound, true},
+		{"unauthorized", http.StatusUnauthorized, false},
+		{"forbidden", http.StatusForbidden, false},
+		{"conflict", http.StatusConflict, false},
+		{"not your turn yet", http.StatusTooEarly, false},
+		{"rate limited", http.StatusTooManyRequests, false},
+		{"server error", http.StatusInternalServerError, false},
+		{"unavailable", http.StatusServiceUnavailable, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := 0
+			router := gin.New()
+			router.POST("/book",
+				func(c *gin.Context) { c.Set(ctxUserKey, models.User{ID: "u1"}) },
+				Idempotent(services.NewIdempotencyService(&services.RedisService{})),
+				func(c *gin.Context) {
+					runs++
+					c.JSON(tt.status, gin.H{"run": runs})
+				})
+
+			send := func(body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/book", strings.NewReader(body))
+				req.Header.Set("Idempotency-Key", "k1")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+
+			first := send(`{"a":1}`)
+			retry := send(`{"a":1}`)
+			if first.Code != tt.status || retry.Code != tt.status {
+				t.Fatalf("statuses = %d, %d, want %d", first.Code, retry.Code, tt.status)
+			}
+			replayed := retry.Header().Get("Idempotent-Replayed") == "true"
+			if replayed != tt.replay {
+				t.Errorf("retry replayed = %v, want %v", replayed, tt.replay)
+			}
+			wantRuns := 2
+			if tt.replay {
+				wantRuns = 1
+				if retry.Body.String() != first.Body.String() {
+					t.Errorf("replayed body %q, want %q", retry.Body.String(), first.Body.String())
+				}
+				if other := send(`{"a":2}`); other.Code != http.StatusUnprocessableEntity {
+					t.Errorf("reused key with another body = %d, want %d", other.Code, http.StatusUnprocessableEntity)
+				}
+			}
+			if runs != wantRuns {
+				t.Errorf("handler ran %d times, want %d", runs, wantRuns)
+			}
+		})
+	}
+}
+
+func TestIdempotentRetriesAfterPreconditionChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		before func(c *gin.Context)
+	}{
+		{"not in the waiting room yet", func(c *gin.Context) {
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Masuk ruang tunggu terlebih dahulu"})
+		}},
+		{"bypass not accepted", func(c *gin.Context) {
+			c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "Pemesanan belum dibuka"})
+		}},
+		{"sold out", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"status": "failed", "message": "Kuota habis"})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready := false
+			router := gin.New()
+			router.POST("/war",
+				func(c *gin.Context) { c.Set(ctxUserKey, models.User{ID: "u1"}) },
+				Idempotent(services.NewIdempotencyService(&services.RedisService{})),
+				func(c *gin.Context) {
+					if !ready {
+						tt.before(c)
+						return
+					}
+					c.JSON(http.StatusOK, gin.H{"status": "success"})
+				})
+
+			send := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/war", strings.NewReader(`{}`))
+				req.Header.Set("Idempotency-Key", "k1")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+
+			send()
+			ready = true
+			retry := send()
+			if retry.Header().Get("Idempotent-Replayed") == "true" {
+				t.Fatalf("retry replayed %q after the precondition changed", retry.Body.String())
+			}
+			if !strings.Contains(retry.Body.String(), `"success"`) {
+				t.Errorf("retry body = %q, want the handler's new answer", retry.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,520 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"war-ticket-engine/models"
+	"war-ticket-engine/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultLocations seeds an empty catalog on first start. After that the
+// catalog is owned by the Database and managed via the admin API.
+var defaultLocations = []models.Location{
+	{ID: "graha-dipta", Name: "Butik Emas LM - Graha Dipta", Region: "jabodetabek", Quota: 30, Enabled: true},
+	{ID: "juanda", Name: "Butik Emas LM - Juanda", Region: "jabodetabek", Quota: 25, Enabled: true},
+	{ID: "gedung-antam", Name: "Butik Emas LM - Gedung Antam", Region: "jabodetabek", Quota: 40, Enabled: true},
+	{ID: "setiabudi-one", Name: "Butik Emas LM - Setiabudi One", Region: "jabodetabek", Quota: 20, Enabled: true},
+}
+
+// defaultSlotStarts are the half-hour arrival windows a location gets
+// when none are configured.
+var defaultSlotStarts = []string{"08:30", "09:00", "09:30", "10:00", "10:30"}
+
+const (
+	dateLayout = "2006-01-02"
+	slotLayout = "15:04"
+)
+
+// defaultTimeSlots spreads a location's quota evenly over the default
+// slots, rounding up so the whole quota can be booked.
+func defaultTimeSlots(quota int64) []models.TimeSlot {
+	n := int64(len(defaultSlotStarts))
+	capacity := (quota + n - 1) / n
+	slots := make([]models.TimeSlot, 0, n)
+	for _, start := range defaultSlotStarts {
+		t, _ := time.Parse(slotLayout, start)
+		slots = append(slots, models.TimeSlot{
+			Start:    start,
+			End:      t.Add(30 * time.Minute).Format(slotLayout),
+			Capacity: capacity,
+		})
+	}
+	return slots
+}
+
+var locationIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// InitLocations seeds the catalog when it is empty and makes sure every
+// location has a quota counter in RedisService.
+func InitLocations(redis *services.RedisService, store services.Store) error {
+	if len(store.ListLocations()) == 0 {
+		now := time.Now()
+		for _, loc := range defaultLocations {
+			loc.Slots = defaultTimeSlots(loc.Quota)
+			loc.CreatedAt = now
+			loc.UpdatedAt = now
+			if _, err := store.AddLocation(loc); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, loc := range store.ListLocations() {
+		if len(loc.Slots) == 0 {
+			updated, err := store.UpdateLocation(loc.ID, func(l *models.Location) error {
+				l.Slots = defaultTimeSlots(l.Quota)
+				return nil
+			})
+			if err != nil {
+				// Keep going with the stored location, so its quota
+				// counter still gets seeded.
+				log.Printf("adding default slots to location %s failed: %v", loc.ID, err)
+			} else {
+				loc = updated
+			}
+		}
+		if err := redis.InitLocationQuota(loc.ID, loc.Quota); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bookableLocation looks up an enabled location and writes the error
+// response itself when the location cannot be booked.
+func bookableLocation(c *gin.Context, store services.Store, id string) (models.Location, bool) {
+	location, exists := store.GetLocation(id)
+	if !exists || !location.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Lokasi tidak valid"})
+		return models.Location{}, false
+	}
+	return location, true
+}
+
+// bookableSlot resolves the visit date and time slot of a booking and
+// writes the error response itself when either is not bookable.
+func bookableSlot(c *gin.Context, location models.Location, rawDate, start string) (time.Time, models.TimeSlot, bool) {
+	visitDate, err := resolveVisitDate(rawDate, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return time.Time{}, models.TimeSlot{}, false
+	}
+	slot, exists := location.Slot(strings.TrimSpace(start))
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Slot waktu tidak valid untuk lokasi ini"})
+		return time.Time{}, models.TimeSlot{}, false
+	}
+	return visitDate, slot, true
+}
+
+// resolveVisitDate parses a YYYY-MM-DD visit date, defaulting to today,
+// and only accepts dates up to BOOKING_DAYS_AHEAD days in the future.
+func resolveVisitDate(raw string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return today, nil
+	}
+
+	date, err := time.ParseInLocation(dateLayout, raw, now.Location())
+	if err != nil {
+		return time.Time{}, errors.New("Format tanggal harus YYYY-MM-DD")
+	}
+	daysAhead := readNonNegativeInt("BOOKING_DAYS_AHEAD", 0)
+	if date.Before(today) || date.After(today.AddDate(0, 0, int(daysAhead))) {
+		return time.Time{}, errors.New("Tanggal kunjungan di luar periode pemesanan")
+	}
+	return date, nil
+}
+
+func GetLocationsHandler(redis *services.RedisService, store services.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		visitDate, err := resolveVisitDate(c.Query("date"), time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		date := visitDate.Format(dateLayout)
+
+		locations := []gin.H{}
+		for _, loc := range store.ListLocations() {
+			if !loc.Enabled {
+				continue
+			}
+			quota, err := redis.GetLocationQuota(loc.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal membaca kuota"})
+				return
+			}
+			slots := make([]gin.H, 0, len(loc.Slots))
+			for _, slot := range loc.Slots {
+				remaining, err := redis.GetSlotQuota(loc.ID, date, slot)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal membaca kuota"})
+					return
+				}
+				slots = append(slots, gin.H{
+					"start":     slot.Start,
+					"end":       slot.End,
+					"capacity":  slot.Capacity,
+					"remaining": max(min(remaining, quota), 0),
+				})
+			}
+			locations = append(locations, gin.H{
+				"id":     loc.ID,
+				"name":   loc.Name,
+				"region": loc.Region,
+				"quota":  max(quota, 0),
+				"date":   date,
+				"slots":  slots,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"locations": locations})
+	}
+}
+
+type CreateLocationRequest struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Region  string            `json:"region"`
+	Quota   int64             `json:"quota"`
+	Enabled *bool             `json:"enabled"`
+	Slots   []models.TimeSlot `json:"slots"`
+}
+
+type UpdateLocationRequest struct {
+	Name   *string `json:"name"`
+	Region *string `json:"region"`
+}
+
+type SetLocationQuotaRequest struct {
+	Quota int64 `json:"quota"`
+}
+
+type SetLocationEnabledRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+type SetLocationSlotsRequest struct {
+	Slots []models.TimeSlot `json:"slots"`
+}
+
+type SetLocationGateRequest struct {
+	Open  string `json:"open"`
+	Close string `json:"close"`
+}
+
+func AdminListLocationsHandler(redis *services.RedisService, store services.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locations := []gin.H{}
+		for _, loc := range store.ListLocations() {
+			remaining, err := redis.GetLocationQuota(loc.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal membaca kuota"})
+				return
+			}
+			locations = append(locations, gin.H{"location": loc, "remaining": remaining})
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success", "locations": locations})
+	}
+}
+
+func AdminCreateLocationHandler(redis *services.RedisService, store services.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateLocationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request"})
+			return
+		}
+
+		req.ID = strings.TrimSpace(req.ID)
+		req.Name = strings.TrimSpace(req.Name)
+		if !locationIDPattern.MatchString(req.ID) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "ID lokasi hanya boleh huruf kecil, angka, dan tanda hubung"})
+			return
+		}
+		if req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Nama lokasi wajib diisi"})
+			return
+		}
+		if req.Quota < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Kuota tidak boleh negatif"})
+			return
+		}
+
+		slots := req.Slots
+		if len(slots) == 0 {
+			slots = defaultTimeSlots(req.Quota)
+		}
+		if err := validateTimeSlots(slots); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+
+		now := time.Now()
+		location := models.Location{
+			ID:        req.ID,
+			Name:      req.Name,
+			Region:    strings.ToLower(strings.TrimSpace(req.Region)),
+			Quota:     req.Quota,
+			Enabled:   req.Enabled == nil || *req.Enabled,
+			Slots:     slots,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		added, err := store.AddLocation(location)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal menyimpan lokasi"})
+			return
+		}
+		if !added {
+			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "ID lokasi sudah digunakan"})
+			return
+		}
+		if err := redis.ResetLocationQuota(location.ID, location.Quota); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Lokasi tersimpan, tetapi kuota gagal diinisialisasi"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"status": "success", "location": location})
+	}
+}
+
+func AdminUpdateLocationHandler(store services.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req UpdateLocationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request"})
+			return
+		}
+		if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Nama lokasi wajib diisi"})
+			return
+		}
+
+		location, err := store.UpdateLocation(c.Param("id"), func(loc *models.Location) error {
+			if req.Name != nil {
+				loc.Name = strings.TrimSpace(*req.Name)
+			}
+			if req.Region != nil {
+				loc.Region = strings.ToLower(strings.TrimSpace(*req.Region))
+			}
+			loc.UpdatedAt = time.Now()
+			return nil
+		})
+		if !respondLocationUpdate(c, err) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "location": location})
+	}
+}
+
+// AdminSetLocationQuotaHandler changes a location's capacity. Seats that
+// were already issued stay issued: the remaining counter is shifted by
+// the difference between the new and the old capacity.
+func AdminSetLocationQuotaHandler(redis *services.RedisService, store services.Store, waitlist *services.WaitlistService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SetLocationQuotaRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request"})
+			return
+		}
+		if req.Quota < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Kuota tidak boleh negatif"})
+			return
+		}
+
+		var delta int64
+		location, err := store.UpdateLocation(c.Param("id"), func(loc *models.Location) error {
+			delta = req.Quota - loc.Quota
+			loc.Quota = req.Quota
+			loc.UpdatedAt = time.Now()
+			return nil
+		})
+		if !respondLocationUpdate(c, err) {
+			return
+		}
+
+		remaining, err := redis.AdjustLocationQuota(location.ID, delta)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Kuota tersimpan, tetapi sisa kuota gagal diperbarui"})
+			return
+		}
+		if delta > 0 {
+			waitlist.LocationReleased(location.ID, delta)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "location": location, "remaining": remaining})
+	}
+}
+
+// AdminResetLocationQuotaHandler refills the remaining quota to the full
+// capacity, e.g. before a new sales day. The reset time is stored so the
+// reconciler counts only tickets issued after it.
+func AdminResetLocationQuotaHandler(redis *services.RedisService, store services.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		location, err := store.UpdateLocation(c.Param("id"), func(loc *models.Location) error {
+			now := time.Now()
+			loc.QuotaResetAt = &now
+			loc.UpdatedAt = now
+			return nil
+		})
+		if !respondLocationUpdate(c, err) {
+			return
+		}
+
+		if err := redis.ResetLocationQuota(location.ID, location.Quota); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal mereset kuota"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "location": location, "remaining": location.Quota})
+	}
+}
+
+func AdminSetLocationEnabledHandler(store services.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SetLocationEnabledRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request"})
+			return
+		}
+
+		location, err := store.UpdateLocation(c.Param("id"), func(loc *models.Location) error {
+			loc.Enabled = req.Enabled
+			loc.UpdatedAt = time.Now()
+			return nil
+		})
+		if !respondLocationUpdate(c, err) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "location": location})
+	}
+}
+
+// AdminSetLocationSlotsHandler replaces a location's time slots. When a
+// slot's capacity changes, the counters of dates already booked are
+// shifted by the difference and added seats go to the slot's waitlist
+// first; dates not booked yet simply start from the new capacity.
+func AdminSetLocationSlotsHandler(redis *services.RedisService, store services.Store, waitlist *services.WaitlistService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SetLocationSlotsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request"})
+			return
+		}
+		if err := validateTimeSlots(req.Slots); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+
+		var previous []models.TimeSlot
+		location, err := store.UpdateLocation(c.Param("id"), func(loc *models.Location) error {
+			previous = loc.Slots
+			loc.Slots = req.Slots
+			loc.UpdatedAt = time.Now()
+			return nil
+		})
+		if !respondLocationUpdate(c, err) {
+			return
+		}
+
+		old := models.Location{Slots: previous}
+		today := time.Now()
+		daysAhead := int(readNonNegativeInt("BOOKING_DAYS_AHEAD", 0))
+		for _, slot := range location.Slots {
+			before, existed := old.Slot(slot.Start)
+			delta := slot.Capacity - before.Capacity
+			if !existed || delta == 0 {
+				continue
+			}
+			for day := 0; day <= daysAhead; day++ {
+				date := today.AddDate(0, 0, day).Format(dateLayout)
+				if err := redis.AdjustSlotQuota(location.ID, date, slot.Start, delta); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Slot tersimpan, tetapi sisa kuota slot gagal diperbarui"})
+					return
+				}
+			}
+			if delta > 0 {
+				waitlist.SlotReleased(location.ID, slot.Start, delta)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "location": location})
+	}
+}
+
+// AdminSetLocationGateHandler overrides the gate open/close times of a
+// location. Empty values fall back to GATE_START_TIME/GATE_CLOSE_TIME.
+func AdminSetLocationGateHandler(store services.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SetLocationGateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request"})
+			return
+		}
+		req.Open = strings.TrimSpace(req.Open)
+		req.Close = strings.TrimSpace(req.Close)
+		if err := services.ValidateGateTimes(req.Open, req.Close); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Jam gate harus HH:MM dan jam tutup setelah jam buka"})
+			return
+		}
+
+		location, err := store.UpdateLocation(c.Param("id"), func(loc *models.Location) error {
+			loc.GateOpen = req.Open
+			loc.GateClose = req.Close
+			loc.UpdatedAt = time.Now()
+			return nil
+		})
+		if !respondLocationUpdate(c, err) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "location": location})
+	}
+}
+
+func validateTimeSlots(slots []models.TimeSlot) error {
+	if len(slots) == 0 {
+		return errors.New("Minimal satu slot waktu")
+	}
+	seen := map[string]bool{}
+	for _, slot := range slots {
+		start, err := time.Parse(slotLayout, slot.Start)
+		if err != nil {
+			return errors.New("Format jam slot harus HH:MM")
+		}
+		end, err := time.Parse(slotLayout, slot.End)
+		if err != nil || !end.After(start) {
+			return errors.New("Jam selesai slot harus setelah jam mulai")
+		}
+		if slot.Capacity < 0 {
+			return errors.New("Kapasitas slot tidak boleh negatif")
+		}
+		if seen[slot.Start] {
+			return errors.New("Jam mulai slot tidak boleh duplikat")
+		}
+		seen[slot.Start] = true
+	}
+	return nil
+}
+
+func respondLocationUpdate(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Lokasi tidak ditemukan"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal menyimpan lokasi"})
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"war-ticket-engine/models"
+	"war-ticket-engine/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ctxUserKey = "auth_user"
+	ctxRoleKey = "auth_role"
+)
+
+// AuthMiddleware resolves the caller from the bearer session token and
+// stores the user on the context. Handlers behind it must use
+// currentUser instead of trusting any user ID from the request body.
+func AuthMiddleware(store services.Store, sessions *services.SessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c.GetHeader("Authorization"))
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Silakan login terlebih dahulu"})
+			return
+		}
+
+		session, err := sessions.Validate(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Sesi tidak valid atau sudah berakhir"})
+			return
+		}
+
+		user, exists := store.GetUser(session.UserID)
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Sesi tidak valid atau sudah berakhir"})
+			return
+		}
+
+		c.Set(ctxUserKey, user)
+		c.Next()
+	}
+}
+
+// RequireRole only lets callers with one of the given roles through and
+// records the role they were let in with. It must run after
+// AuthMiddleware. Users listed in ADMIN_EMAILS are treated as admins so
+// the first operator can be bootstrapped.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	adminEmails := map[string]bool{}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			adminEmails[email] = true
+		}
+	}
+
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		role := user.Role
+		if adminEmails[strings.ToLower(user.Email)] {
+			role = models.RoleAdmin
+		}
+		if !slices.Contains(roles, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "error", "message": "Akses ditolak"})
+			return
+		}
+		c.Set(ctxRoleKey, role)
+		c.Next()
+	}
+}
+
+func currentUser(c *gin.Context) models.User {
+	if v, ok := c.Get(ctxUserKey); ok {
+		if user, ok := v.(models.User); ok {
+			return user
+		}
+	}
+	return models.User{}
+}
+
+func bearerToken(header string) string {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"war-ticket-engine/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queueToken reads the waiting room token from the X-Queue-Token header,
+// falling back to the token query parameter.
+func queueToken(c *gin.Context) string {
+	if token := strings.TrimSpace(c.GetHeader("X-Queue-Token")); token != "" {
+		return token
+	}
+	return strings.TrimSpace(c.Query("token"))
+}
+
+func JoinQueueHandler(queue *services.QueueService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticket, err := queue.Join(currentUser(c).ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal masuk ruang tunggu"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success", "queue": ticket})
+	}
+}
+
+func QueueStatusHandler(queue *services.QueueService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticket, err := queue.Status(queueToken(c), currentUser(c).ID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Token antrean tidak valid"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success", "queue": ticket})
+	}
+}
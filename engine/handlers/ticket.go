@@ -1,15 +1,14 @@
 package handlers
 
 import (
-	"crypto/rand"
-	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
 	"time"
 	"war-ticket-engine/models"
 	"war-ticket-engine/services"
@@ -17,52 +16,14 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var (
-	// Location quotas (atomic) and metadata
-	locationData = map[string]struct {
-		Name   string
-		Region string
-		Quota  *int64
-	}{
-		"graha-dipta":   {Name: "Butik Emas LM - Graha Dipta", Region: "jabodetabek", Quota: new(int64)},
-		"juanda":        {Name: "Butik Emas LM - Juanda", Region: "jabodetabek", Quota: new(int64)},
-		"gedung-antam":  {Name: "Butik Emas LM - Gedung Antam", Region: "jabodetabek", Quota: new(int64)},
-		"setiabudi-one": {Name: "Butik Emas LM - Setiabudi One", Region: "jabodetabek", Quota: new(int64)},
-	}
-
-	ticketCounter int64 = 0
-	ticketsMu     sync.RWMutex
-)
-
-func init() {
-	// Initialize quotas
-	*locationData["graha-dipta"].Quota = 30
-	*locationData["juanda"].Quota = 25
-	*locationData["gedung-antam"].Quota = 40
-	*locationData["setiabudi-one"].Quota = 20
-}
-
-func generateTicketNumber() string {
-	num := atomic.AddInt64(&ticketCounter, 1)
-	letters := []byte("ABCDEFGHJKLMNPQRSTUVWXYZ")
-	prefix := string(letters[num%24]) + string(letters[(num/24)%24]) + string(letters[(num/576)%24])
-	return fmt.Sprintf("%s%d-%03d", prefix, (num/1000)%10, num%1000)
-}
-
-func generateCode() string {
-	bytes := make([]byte, 3)
-	rand.Read(bytes)
-	return fmt.Sprintf("%s%s", hex.EncodeToString(bytes)[:3], hex.EncodeToString(bytes)[3:])
-}
-
 type CreateTicketRequest struct {
-	UserID     string  `json:"user_id"`
 	LocationID string  `json:"location_id"`
+	Date       string  `json:"date,omitempty"`
 	TimeSlot   string  `json:"time_slot"`
 	SizeGram   float64 `json:"size_gram,omitempty"`
 }
 
-func CreateTicketHandler() gin.HandlerFunc {
+func CreateTicketHandler(redis *services.RedisService, store services.Store, gate *services.GateService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req CreateTicketRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -70,35 +31,22 @@ func CreateTicketHandler() gin.HandlerFunc {
 			return
 		}
 
-		location, exists := locationData[req.LocationID]
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Lokasi tidak valid"})
+		location, ok := bookableLocation(c, store, req.LocationID)
+		if !ok {
 			return
 		}
-
-		// Atomic decrease
-		remaining := atomic.AddInt64(location.Quota, -1)
-		if remaining < 0 {
-			atomic.AddInt64(location.Quota, 1) // Rollback
-			c.JSON(http.StatusOK, gin.H{
-				"status":  "failed",
-				"message": "Kuota habis untuk lokasi ini",
-			})
+		if !gateAllows(c, gate, location.ID, false) {
 			return
 		}
-
-		ticket := models.Ticket{
-			ID:           generateID(),
-			UserID:       req.UserID,
-			LocationID:   req.LocationID,
-			LocationName: location.Name,
-			TicketNumber: generateTicketNumber(),
-			Code:         strings.ToUpper(generateCode()),
-			TimeSlot:     req.TimeSlot,
-			CreatedAt:    time.Now(),
+		visitDate, slot, ok := bookableSlot(c, location, req.Date, req.TimeSlot)
+		if !ok {
+			return
 		}
 
-		services.DB.SetTicket(ticket)
+		ticket, ok := issueTicket(c, redis, store, location, visitDate, slot)
+		if !ok {
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "success",
@@ -108,36 +56,94 @@ func CreateTicketHandler() gin.HandlerFunc {
 	}
 }
 
-func GetLocationsHandler() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		locations := []gin.H{}
-		for id, loc := range locationData {
-			quota := atomic.LoadInt64(loc.Quota)
-			locations = append(locations, gin.H{
-				"id":     id,
-				"name":   loc.Name,
-				"region": loc.Region,
-				"quota":  quota,
+// issueTicket runs the booking steps shared by the normal and pre-open
+// flows: holding limit, atomic seat decrement and persistence. On
+// failure it writes the response itself and returns false.
+func issueTicket(c *gin.Context, redis *services.RedisService, store services.Store, location models.Location, visitDate time.Time, slot models.TimeSlot) (models.Ticket, bool) {
+	user := currentUser(c)
+	if !acquireHolding(c, redis, user, location.ID, visitDate) {
+		return models.Ticket{}, false
+	}
+
+	// Atomic decrease of location and slot quota
+	date := visitDate.Format(dateLayout)
+	_, _, err := redis.DecreaseSlotQuota(location.ID, date, slot)
+	if err != nil {
+		redis.ReleaseHolding(user.NIK, location.ID, visitDate)
+		switch {
+		case errors.Is(err, services.ErrQuotaExhausted):
+			c.JSON(http.StatusOK, gin.H{
+				"status":   "failed",
+				"message":  "Kuota habis untuk lokasi ini",
+				"waitlist": true,
+			})
+		case errors.Is(err, services.ErrSlotFull):
+			c.JSON(http.StatusOK, gin.H{
+				"status":   "failed",
+				"code":     "slot_full",
+				"message":  "Slot waktu ini sudah penuh, silakan pilih slot lain",
+				"waitlist": true,
 			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal memproses kuota"})
+		}
+		return models.Ticket{}, false
+	}
+
+	ticket, err := services.NewTicket(redis, store, user, location, date, slot.Start)
+	if err != nil {
+		if err := releaseSeat(redis, store, models.Ticket{LocationID: location.ID, Date: date, TimeSlot: slot.Start}, user.NIK); err != nil {
+			log.Printf("seat at %s not released after numbering failure: %v", location.ID, err)
 		}
-		c.JSON(http.StatusOK, gin.H{"locations": locations})
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal membuat tiket"})
+		return models.Ticket{}, false
+	}
+
+	// The seat only counts as sold once the ticket is on disk; until then
+	// it is a reservation that is rolled back on failure (or by the
+	// reconciler if this process dies in between).
+	reservation := services.Reservation{
+		TicketID:     ticket.ID,
+		NIK:          user.NIK,
+		LocationID:   location.ID,
+		Date:         date,
+		Slot:         slot,
+		HoldingScope: location.ID,
+	}
+	if err := redis.Reserve(reservation); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal memproses kuota"})
+		return models.Ticket{}, false
+	}
+	if err := store.SaveTicket(ticket); err != nil {
+		log.Printf("ticket %s not stored, rolling back seat: %v", ticket.ID, err)
+		if err := redis.RollbackReservation(reservation); err != nil {
+			log.Printf("reservation %s rollback failed: %v", ticket.ID, err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal menyimpan tiket"})
+		return models.Ticket{}, false
+	}
+	commitReservation(redis, reservation)
+	return ticket, true
+}
+
+// commitReservation settles a reservation whose ticket is stored. A
+// failure here only leaves the ledger entry behind; the reconciler sees
+// the ticket and drops it.
+func commitReservation(redis *services.RedisService, reservation services.Reservation) {
+	if _, err := redis.CommitReservation(reservation); err != nil {
+		log.Printf("reservation %s commit failed: %v", reservation.TicketID, err)
 	}
 }
 
 type PreOpenTicketRequest struct {
-	UserID     string  `json:"user_id"`
 	LocationID string  `json:"location_id"`
+	Date       string  `json:"date,omitempty"`
 	TimeSlot   string  `json:"time_slot"`
 	SizeGram   float64 `json:"size_gram"`
 }
 
-func PreOpenTicketHandler() gin.HandlerFunc {
+func PreOpenTicketHandler(redis *services.RedisService, store services.Store, gate *services.GateService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if !inPreOpenWindow() {
-			c.JSON(http.StatusTooEarly, gin.H{"status": "error", "message": "Pre-open belum dibuka"})
-			return
-		}
-
 		var req PreOpenTicketRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request"})
@@ -150,39 +156,27 @@ func PreOpenTicketHandler() gin.HandlerFunc {
 			return
 		}
 
-		loc, exists := locationData[req.LocationID]
-		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Lokasi tidak valid"})
+		loc, ok := bookableLocation(c, store, req.LocationID)
+		if !ok {
+			return
+		}
+		if !gateAllows(c, gate, loc.ID, true) {
 			return
 		}
 		if strings.ToLower(loc.Region) != "jabodetabek" {
 			c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "Lokasi hanya untuk area Jabodetabek selama pre-open"})
 			return
 		}
-
-		remaining := atomic.AddInt64(loc.Quota, -1)
-		if remaining < 0 {
-			atomic.AddInt64(loc.Quota, 1)
-			c.JSON(http.StatusOK, gin.H{
-				"status":  "failed",
-				"message": "Kuota habis untuk lokasi ini",
-			})
+		visitDate, slot, ok := bookableSlot(c, loc, req.Date, req.TimeSlot)
+		if !ok {
 			return
 		}
 
-		ticket := models.Ticket{
-			ID:           generateID(),
-			UserID:       req.UserID,
-			LocationID:   req.LocationID,
-			LocationName: loc.Name,
-			TicketNumber: generateTicketNumber(),
-			Code:         strings.ToUpper(generateCode()),
-			TimeSlot:     req.TimeSlot,
-			CreatedAt:    time.Now(),
+		ticket, ok := issueTicket(c, redis, store, loc, visitDate, slot)
+		if !ok {
+			return
 		}
 
-		services.DB.SetTicket(ticket)
-
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "success",
 			"message": "Tiket pre-open berhasil dibuat",
@@ -191,26 +185,35 @@ func PreOpenTicketHandler() gin.HandlerFunc {
 	}
 }
 
-func inPreOpenWindow() bool {
-	startCfg := strings.TrimSpace(os.Getenv("GATE_START_TIME"))
-	if startCfg == "" {
-		startCfg = "07:00"
-	}
-	offsetMinutes := 10
-	if raw := strings.TrimSpace(os.Getenv("PREOPEN_OFFSET_MINUTES")); raw != "" {
-		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
-			offsetMinutes = v
-		}
+// acquireHolding enforces the per-NIK daily holding limit and writes the
+// "already booked" response itself when the caller is over the limit.
+func acquireHolding(c *gin.Context, redis *services.RedisService, user models.User, locationID string, day time.Time) bool {
+	err := redis.AcquireHolding(user.NIK, locationID, day, services.ReadHoldingLimits())
+	if errors.Is(err, services.ErrAlreadyBooked) {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "failed",
+			"code":    "already_booked",
+			"message": "NIK ini sudah memiliki tiket untuk hari ini",
+		})
+		return false
 	}
-
-	now := time.Now()
-	todayStart, err := time.ParseInLocation("15:04", startCfg, now.Location())
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal memeriksa kepemilikan tiket"})
 		return false
 	}
-	start := time.Date(now.Year(), now.Month(), now.Day(), todayStart.Hour(), todayStart.Minute(), 0, 0, now.Location())
-	windowStart := start.Add(-time.Duration(offsetMinutes) * time.Minute)
-	return now.After(windowStart) && now.Before(start)
+	return true
+}
+
+func readNonNegativeInt(key string, fallback int64) int64 {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	val, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || val < 0 {
+		return fallback
+	}
+	return val
 }
 
 func readMinPreOpenSize() float64 {
@@ -225,16 +228,318 @@ func readMinPreOpenSize() float64 {
 	return val
 }
 
-func GetTicketHandler() gin.HandlerFunc {
+// MyTicketsHandler lists the caller's tickets, including war tickets still
+// being written, with their current status (active, cancelled, redeemed,
+// no_show or expired). Query parameters: status to filter, sort=visit (default)
+// or created, order=desc (default) or asc, page and per_page (max 100).
+func MyTicketsHandler(store services.Store, writer *services.TicketWriter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+
+		statusFilter := c.Query("status")
+		switch statusFilter {
+		case "", models.TicketActive, models.TicketCancelled, models.TicketRedeemed, models.TicketNoShow, models.TicketExpired:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Status tidak dikenal"})
+			return
+		}
+		sortBy := c.DefaultQuery("sort", "visit")
+		order := c.DefaultQuery("order", "desc")
+		if (sortBy != "visit" && sortBy != "created") || (order != "asc" && order != "desc") {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Urutan tidak dikenal"})
+			return
+		}
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Halaman tidak valid"})
+			return
+		}
+		perPage, err := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+		if err != nil || perPage < 1 || perPage > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "per_page harus 1-100"})
+			return
+		}
+
+		byID := make(map[string]models.Ticket)
+		for _, ticket := range store.TicketsByUser(user.ID) {
+			byID[ticket.ID] = ticket
+		}
+		pending, err := writer.PendingTickets()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal memuat tiket"})
+			return
+		}
+		for _, ticket := range pending {
+			if _, stored := byID[ticket.ID]; !stored && ticket.UserID == user.ID {
+				byID[ticket.ID] = ticket
+			}
+		}
+
+		now := time.Now()
+		tickets := make([]models.Ticket, 0, len(byID))
+		for _, ticket := range byID {
+			ticket.Status = services.TicketStatus(store, ticket, now)
+			if statusFilter == "" || ticket.Status == statusFilter {
+				tickets = append(tickets, ticket)
+			}
+		}
+		sort.Slice(tickets, func(i, j int) bool {
+			a, b := tickets[i], tickets[j]
+			if order == "desc" {
+				a, b = b, a
+			}
+			if sortBy == "visit" && (a.Date != b.Date || a.TimeSlot != b.TimeSlot) {
+				if a.Date != b.Date {
+					return a.Date < b.Date
+				}
+				return a.TimeSlot < b.TimeSlot
+			}
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+			return a.ID < b.ID
+		})
+
+		total := len(tickets)
+		start := min((page-1)*perPage, total)
+		end := min(start+perPage, total)
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":   "success",
+			"tickets":  tickets[start:end],
+			"page":     page,
+			"per_page": perPage,
+			"total":    total,
+		})
+	}
+}
+
+func GetTicketHandler(store services.Store, writer *services.TicketWriter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticket, ok := ownTicket(c, store, writer)
+		if !ok {
+			return
+		}
+
+		ticket.Status = services.TicketStatus(store, ticket, time.Now())
+		c.JSON(http.StatusOK, gin.H{"status": "success", "ticket": ticket})
+	}
+}
+
+// TicketQRHandler renders the signed pass of an active ticket as a QR
+// code for scanning at the door: PNG by default, SVG with ?format=svg,
+// ?size= pixels wide (128-1024, default 256).
+func TicketQRHandler(store services.Store, writer *services.TicketWriter, passes *services.TicketPassService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		ticket, ok := ownTicket(c, store, writer)
+		if !ok {
+			return
+		}
+		if !ticket.CanTransition(models.TicketRedeemed) {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":        "error",
+				"message":       "Tiket sudah tidak aktif",
+				"ticket_status": ticket.CurrentStatus(),
+			})
+			return
+		}
+
+		size := 256
+		if raw := c.Query("size"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 128 || parsed > 1024 {
+				c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Ukuran QR harus 128-1024"})
+				return
+			}
+			size = parsed
+		}
+
+		payload, pass, err := passes.Sign(ticket)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal membuat QR tiket"})
+			return
+		}
+		if time.Now().After(pass.ExpiresAt) {
+			c.JSON(http.StatusGone, gin.H{"status": "error", "message": "Tiket sudah kedaluwarsa"})
+			return
+		}
+
+		var image []byte
+		contentType := "image/png"
+		switch c.DefaultQuery("format", "png") {
+		case "png":
+			image, err = services.RenderQRPNG(payload, size)
+		case "svg":
+			contentType = "image/svg+xml"
+			image, err = services.RenderQRSVG(payload, size)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Format QR harus png atau svg"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal membuat QR tiket"})
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.Header("X-Ticket-Pass-Expires", pass.ExpiresAt.Format(time.RFC3339))
+		c.Data(http.StatusOK, contentType, image)
+	}
+}
+
+// ownTicket looks up the ticket in the id param for the current user,
+// responding 404 when it does not exist or belongs to someone else.
+func ownTicket(c *gin.Context, store services.Store, writer *services.TicketWriter) (models.Ticket, bool) {
+	ticketID := c.Param("id")
+
+	ticket, exists := store.GetTicket(ticketID)
+	if !exists {
+		// War tickets are written behind the request; one that was
+		// just won may still be queued.
+		ticket, exists = writer.Pending(ticketID)
+	}
+	if !exists || ticket.UserID != currentUser(c).ID {
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Tiket tidak ditemukan"})
+		return models.Ticket{}, false
+	}
+	return ticket, true
+}
+
+var (
+	errNotTicketOwner = errors.New("not the ticket owner")
+	errCancelCutoff   = errors.New("cancellation cutoff passed")
+)
+
+// CancelTicketHandler lets the owner give a ticket back until
+// CANCEL_CUTOFF_MINUTES (default 60) before the start of its time slot;
+// war tickets, which have no slot, until the end of their date. The
+// ticket is marked cancelled on disk first and only then is the seat
+// returned (to the waitlist first, if anyone is waiting), so a crash in
+// between can only under-sell, which the reconciler repairs.
+func CancelTicketHandler(redis *services.RedisService, store services.Store, writer *services.TicketWriter, waitlist *services.WaitlistService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
 		ticketID := c.Param("id")
+		if pending, queued := writer.Pending(ticketID); queued && pending.UserID == user.ID {
+			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "Tiket masih diproses, coba lagi sebentar"})
+			return
+		}
 
-		ticket, exists := services.DB.GetTicket(ticketID)
-		if !exists {
+		now := time.Now()
+		cutoff := time.Duration(readNonNegativeInt("CANCEL_CUTOFF_MINUTES", 60)) * time.Minute
+		var current string
+		ticket, err := store.UpdateTicket(ticketID, func(t *models.Ticket) error {
+			if t.UserID != user.ID {
+				return errNotTicketOwner
+			}
+			current = t.CurrentStatus()
+			if !t.CanTransition(models.TicketCancelled) {
+				return models.ErrInvalidTransition
+			}
+			deadline, err := cancelDeadline(*t, cutoff)
+			if err != nil {
+				return err
+			}
+			if !now.Before(deadline) {
+				return errCancelCutoff
+			}
+			return t.Transition(models.TicketCancelled, now, user.ID)
+		})
+		switch {
+		case err == nil:
+		case errors.Is(err, services.ErrNotFound), errors.Is(err, errNotTicketOwner):
 			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Tiket tidak ditemukan"})
 			return
+		case errors.Is(err, models.ErrInvalidTransition):
+			c.JSON(http.StatusConflict, gin.H{
+				"status":        "error",
+				"message":       "Tiket sudah tidak aktif",
+				"ticket_status": current,
+			})
+			return
+		case errors.Is(err, errCancelCutoff):
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  "error",
+				"code":    "cancel_cutoff_passed",
+				"message": "Batas waktu pembatalan sudah lewat",
+			})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal membatalkan tiket"})
+			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"status": "success", "ticket": ticket})
+		if err := cancelSeat(redis, store, waitlist, ticket, user.NIK); err != nil {
+			log.Printf("ticket %s cancelled but seat not released: %v", ticket.ID, err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "Tiket berhasil dibatalkan",
+			"ticket":  ticket,
+		})
+	}
+}
+
+// cancelDeadline is the last moment a ticket may be cancelled.
+func cancelDeadline(ticket models.Ticket, cutoff time.Duration) (time.Time, error) {
+	if ticket.LocationID == services.WarQuotaID || ticket.TimeSlot == "" {
+		day, err := time.ParseInLocation(dateLayout, ticket.Date, time.Local)
+		return day.AddDate(0, 0, 1), err
+	}
+	start, err := time.ParseInLocation(dateLayout+" "+slotLayout, ticket.Date+" "+ticket.TimeSlot, time.Local)
+	return start.Add(-cutoff), err
+}
+
+// cancelSeat frees the seat of a cancelled ticket. A slot seat goes to
+// the slot's waitlist first and back to the public pool only when nobody
+// is waiting.
+func cancelSeat(redis *services.RedisService, store services.Store, waitlist *services.WaitlistService, ticket models.Ticket, nik string) error {
+	if ticket.LocationID == services.WarQuotaID {
+		return releaseSeat(redis, store, ticket, nik)
+	}
+	location, exists := store.GetLocation(ticket.LocationID)
+	if !exists {
+		return services.ErrNotFound
+	}
+	if _, exists := location.Slot(ticket.TimeSlot); !exists {
+		return releaseSeat(redis, store, ticket, nik)
+	}
+	day, err := time.ParseInLocation(dateLayout, ticket.Date, time.Local)
+	if err != nil {
+		return err
+	}
+	waitlist.Released(ticket.LocationID, ticket.Date, ticket.TimeSlot)
+	return redis.ReleaseHolding(nik, ticket.LocationID, day)
+}
+
+// releaseSeat gives the seat of a cancelled ticket back to its quota
+// counters and frees the NIK's holding for that day.
+func releaseSeat(redis *services.RedisService, store services.Store, ticket models.Ticket, nik string) error {
+	day, err := time.ParseInLocation(dateLayout, ticket.Date, time.Local)
+	if err != nil {
+		return err
+	}
+	if ticket.LocationID == services.WarQuotaID {
+		if _, err := redis.IncreaseQuota(); err != nil {
+			return err
+		}
+		return redis.ReleaseHolding(nik, warHoldingScope, day)
+	}
+
+	location, exists := store.GetLocation(ticket.LocationID)
+	if !exists {
+		return services.ErrNotFound
+	}
+	slot, exists := location.Slot(ticket.TimeSlot)
+	if !exists {
+		// The slot was removed since booking; only the location seat
+		// can go back.
+		if _, err := redis.IncreaseLocationQuota(ticket.LocationID); err != nil {
+			return err
+		}
+	} else if err := redis.IncreaseSlotQuota(ticket.LocationID, ticket.Date, slot); err != nil {
+		return err
 	}
+	return redis.ReleaseHolding(nik, ticket.LocationID, day)
 }
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"war-ticket-engine/models"
+	"war-ticket-engine/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SetUserRoleRequest struct {
+	Role       string `json:"role"`
+	LocationID string `json:"location_id"`
+}
+
+// AdminSetUserRoleHandler grants or revokes the staff and admin roles.
+// Staff must be assigned the boutique they work at; admins may be, and
+// plain users never are.
+func AdminSetUserRoleHandler(store services.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SetUserRoleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request"})
+			return
+		}
+		switch req.Role {
+		case models.RoleUser, models.RoleStaff, models.RoleAdmin:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Role harus user, staff, atau admin"})
+			return
+		}
+		switch {
+		case req.Role == models.RoleUser:
+			req.LocationID = ""
+		case req.LocationID != "":
+			if _, exists := store.GetLocation(req.LocationID); !exists {
+				c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Lokasi tidak valid"})
+				return
+			}
+		case req.Role == models.RoleStaff:
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Butik tempat staf bertugas wajib diisi"})
+			return
+		}
+
+		user, err := store.UpdateUser(c.Param("id"), func(u *models.User) error {
+			u.Role = req.Role
+			u.LocationID = req.LocationID
+			return nil
+		})
+		if errors.Is(err, services.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Pengguna tidak ditemukan"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal mengubah role"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"user": gin.H{
+				"id":          user.ID,
+				"nama":        user.Nama,
+				"email":       user.Email,
+				"role":        user.Role,
+				"location_id": user.LocationID,
+			},
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"war-ticket-engine/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WaitlistRequest struct {
+	LocationID string `json:"location_id"`
+	Date       string `json:"date,omitempty"`
+	TimeSlot   string `json:"time_slot"`
+}
+
+// JoinWaitlistHandler queues the caller for a sold-out slot. Joining is
+// refused while seats are still available.
+func JoinWaitlistHandler(redis *services.RedisService, store services.Store, waitlist *services.WaitlistService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req WaitlistRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request"})
+			return
+		}
+
+		location, ok := bookableLocation(c, store, req.LocationID)
+		if !ok {
+			return
+		}
+		visitDate, slot, ok := bookableSlot(c, location, req.Date, req.TimeSlot)
+		if !ok {
+			return
+		}
+		date := visitDate.Format(dateLayout)
+
+		locationLeft, err := redis.GetLocationQuota(location.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal memeriksa kuota"})
+			return
+		}
+		slotLeft, err := redis.GetSlotQuota(location.ID, date, slot)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal memeriksa kuota"})
+			return
+		}
+		if locationLeft > 0 && slotLeft > 0 {
+			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "Kuota masih tersedia, silakan ambil antrean langsung"})
+			return
+		}
+
+		position, err := waitlist.Join(currentUser(c).ID, location.ID, date, slot.Start)
+		if errors.Is(err, services.ErrWaitlistJoined) {
+			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "Anda sudah terdaftar di waitlist ini"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal mendaftar waitlist"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Berhasil masuk waitlist", "waitlist": position})
+	}
+}
+
+// LeaveWaitlistHandler takes the caller off a waitlist given by the
+// location_id, date and time_slot query parameters.
+func LeaveWaitlistHandler(store services.Store, waitlist *services.WaitlistService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locationID := strings.TrimSpace(c.Query("location_id"))
+		location, exists := store.GetLocation(locationID)
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Lokasi tidak valid"})
+			return
+		}
+		visitDate, slot, ok := bookableSlot(c, location, c.Query("date"), c.Query("time_slot"))
+		if !ok {
+			return
+		}
+
+		removed, err := waitlist.Leave(currentUser(c).ID, location.ID, visitDate.Format(dateLayout), slot.Start)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal keluar dari waitlist"})
+			return
+		}
+		if !removed {
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Anda tidak terdaftar di waitlist ini"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Berhasil keluar dari waitlist"})
+	}
+}
+
+// MyWaitlistHandler lists the caller's waitlist places and open offers.
+func MyWaitlistHandler(waitlist *services.WaitlistService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		entries, err := waitlist.Entries(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal memuat waitlist"})
+			return
+		}
+		offers, err := waitlist.Offers(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal memuat waitlist"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "waitlist": entries, "offers": offers})
+	}
+}
+
+func ClaimWaitlistOfferHandler(waitlist *services.WaitlistService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticket, err := waitlist.Claim(c.Param("id"), currentUser(c))
+		switch {
+		case err == nil:
+		case errors.Is(err, services.ErrOfferNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Penawaran tidak ditemukan atau sudah kedaluwarsa"})
+			return
+		case errors.Is(err, services.ErrAlreadyBooked):
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  "failed",
+				"code":    "already_booked",
+				"message": "NIK ini sudah memiliki tiket untuk hari ini",
+			})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal mengklaim penawaran"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Tiket berhasil dibuat", "ticket": ticket})
+	}
+}
+
+func DeclineWaitlistOfferHandler(waitlist *services.WaitlistService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := waitlist.Decline(c.Param("id"), currentUser(c).ID)
+		if errors.Is(err, services.ErrOfferNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Penawaran tidak ditemukan atau sudah kedaluwarsa"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal menolak penawaran"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Penawaran ditolak"})
+	}
+}
@@ -1,37 +1,66 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
+	"time"
+	"war-ticket-engine/models"
 	"war-ticket-engine/services"
 
 	"github.com/gin-gonic/gin"
 )
 
+// warHoldingScope is the location key used for holding limits on the
+// global war quota, which is not tied to a boutique.
+const warHoldingScope = "war"
+
+const warLocationName = "War Tiket"
+
 type WarRequest struct {
-	UserID string `json:"user_id"`
-	Name   string `json:"name"`
+	Name string `json:"name"`
 }
 
-func WarHandler(redis *services.RedisService) gin.HandlerFunc {
+// WarHandler only lets callers through that hold an admitted waiting
+// room token (see QueueService), so the decrement below sees a steady
+// stream instead of the whole crowd at once. Winning tickets are handed
+// to the TicketWriter so the hot path never waits on the database.
+func WarHandler(redis *services.RedisService, store services.Store, queue *services.QueueService, gate *services.GateService, writer *services.TicketWriter) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req WarRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 			return
 		}
+		if !gateAllows(c, gate, services.WarQuotaID, false) {
+			return
+		}
+
+		user := currentUser(c)
+		now := time.Now()
+		// The holding is taken before the queue token is spent, so a NIK
+		// that already has its ticket keeps its place in line.
+		if !acquireHolding(c, redis, user, warHoldingScope, now) {
+			return
+		}
+
+		// The queue admits nobody while the gate is shut, so a request let
+		// through on a QA/audit bypass token skips it.
+		if _, bypassed := c.Get(ctxGateBypassKey); !bypassed && !consumeQueueToken(c, queue, user.ID) {
+			redis.ReleaseHolding(user.NIK, warHoldingScope, now)
+			return
+		}
 
-		// Atomic DECR
+		// Atomic DECR, never below zero
 		remaining, err := redis.AtomicDecreaseQuota()
 		if err != nil {
+			redis.ReleaseHolding(user.NIK, warHoldingScope, now)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Redis error"})
 			return
 		}
 
 		if remaining < 0 {
-			// Rollback (optional, or just ignore since it's < 0)
-			// For high perf, we might not INCR back immediately to avoid thrashing,
-			// but effectively stock is empty.
+			redis.ReleaseHolding(user.NIK, warHoldingScope, now)
 			c.JSON(http.StatusOK, gin.H{
 				"status":    "failed",
 				"message":   "Quota habis",
@@ -40,17 +69,70 @@ func WarHandler(redis *services.RedisService) gin.HandlerFunc {
 			return
 		}
 
-		// Success logic - Queue to DB (Simulated here)
-		// go database.SaveTicket(...)
+		ticket, err := services.NewTicket(redis, store, user, models.Location{ID: services.WarQuotaID, Name: warLocationName}, now.Format(dateLayout), "")
+		if err != nil {
+			if err := releaseSeat(redis, store, models.Ticket{LocationID: services.WarQuotaID, Date: now.Format(dateLayout)}, user.NIK); err != nil {
+				log.Printf("war seat not released after numbering failure: %v", err)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Redis error"})
+			return
+		}
+		// The seat is committed once the ticket sits in the durable write
+		// queue; if it cannot be queued the seat goes back.
+		reservation := services.Reservation{
+			TicketID:     ticket.ID,
+			NIK:          user.NIK,
+			LocationID:   services.WarQuotaID,
+			Date:         ticket.Date,
+			HoldingScope: warHoldingScope,
+		}
+		if err := redis.Reserve(reservation); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Redis error"})
+			return
+		}
+		if err := writer.Enqueue(ticket); err != nil {
+			log.Printf("war ticket %s not queued, rolling back seat: %v", ticket.ID, err)
+			if err := redis.RollbackReservation(reservation); err != nil {
+				log.Printf("reservation %s rollback failed: %v", ticket.ID, err)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Gagal menyimpan tiket"})
+			return
+		}
+		commitReservation(redis, reservation)
 
 		c.JSON(http.StatusOK, gin.H{
 			"status":        "success",
-			"ticket_number": fmt.Sprintf("T-%d", 5000-remaining),
+			"ticket_id":     ticket.ID,
+			"ticket_number": ticket.TicketNumber,
+			"ticket":        ticket,
 			"remaining":     remaining,
 		})
 	}
 }
 
+func consumeQueueToken(c *gin.Context, queue *services.QueueService, userID string) bool {
+	token := queueToken(c)
+	err := queue.Consume(token, userID)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrQueueNotAdmitted):
+		status, _ := queue.Status(token, userID)
+		c.JSON(http.StatusTooEarly, gin.H{
+			"status":   "waiting",
+			"message":  "Belum giliran Anda",
+			"position": status.Position,
+		})
+	case errors.Is(err, services.ErrQueueTokenUsed):
+		c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "Token antrean sudah digunakan"})
+	case errors.Is(err, services.ErrQueueTokenInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Masuk ruang tunggu terlebih dahulu"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Queue error"})
+	}
+	return false
+}
+
 func StatusHandler(redis *services.RedisService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		count, _ := redis.GetQuota()
@@ -1,23 +1,59 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"war-ticket-engine/handlers"
+	"war-ticket-engine/models"
 	"war-ticket-engine/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
+	if err := services.CheckSecrets(); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+
+	store, err := services.OpenStore()
+	if err != nil {
+		log.Fatalf("Store init failed: %v", err)
+	}
+
 	// Initialize services
 	redisService := services.NewRedisService()
 	captchaService := services.NewCaptchaService()
+	sessionService := services.NewSessionService(redisService)
+	bypassService := services.NewBypassService()
+	gateService := services.NewGateService(redisService, store, bypassService)
+	queueService := services.NewQueueService(redisService, gateService)
+	idempotencyService := services.NewIdempotencyService(redisService)
+	ticketWriter := services.NewTicketWriter(redisService, store)
+	reconciler := services.NewReconciler(redisService, store, ticketWriter)
+	waitlistService := services.NewWaitlistService(redisService, store, services.NewNotifier())
+	ticketPassService := services.NewTicketPassService(store)
+
+	if err := handlers.InitLocations(redisService, store); err != nil {
+		log.Printf("Location init failed: %v", err)
+	}
 
-	// Initialize JSON Database
-	services.InitDatabase("database.json")
+	ticketWriter.Start()
+	reconciler.Start()
+	waitlistService.Start()
+	gateService.Start()
+	queueService.Start()
 
 	// Initialize RAG service
 	ragPath := os.Getenv("RAG_DOC_PATH")
@@ -35,8 +71,8 @@ func main() {
 	// CORS
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Queue-Token, X-Gate-Bypass, Idempotency-Key")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -48,23 +84,60 @@ func main() {
 
 	// Routes
 	api := r.Group("/api")
+	auth := handlers.AuthMiddleware(store, sessionService)
+	idempotent := handlers.Idempotent(idempotencyService)
 	{
 		// War tiket (original)
-		api.POST("/war", handlers.WarHandler(redisService))
+		api.POST("/war/queue", auth, handlers.JoinQueueHandler(queueService))
+		api.GET("/war/queue", auth, handlers.QueueStatusHandler(queueService))
+		api.POST("/war", auth, idempotent, handlers.WarHandler(redisService, store, queueService, gateService, ticketWriter))
 		api.GET("/status", handlers.StatusHandler(redisService))
+		api.GET("/events", handlers.EventsHandler(redisService, queueService))
+		api.GET("/gate", handlers.GateStatusHandler(gateService))
 
 		// Authentication
-		api.POST("/register", handlers.RegisterHandler(captchaService))
-		api.POST("/login", handlers.LoginHandler(captchaService))
+		api.POST("/register", handlers.RegisterHandler(store, captchaService))
+		api.POST("/login", handlers.LoginHandler(store, captchaService, sessionService))
+		api.POST("/session/refresh", handlers.RefreshSessionHandler(sessionService))
+		api.POST("/logout", handlers.LogoutHandler(sessionService))
 
 		// Captcha
 		api.GET("/captcha/math", handlers.MathCaptchaHandler(captchaService))
 		api.GET("/captcha/image", handlers.ImageCaptchaHandler(captchaService))
 
 		// Tickets & Locations
-		api.POST("/ticket", handlers.CreateTicketHandler())
-		api.GET("/ticket/:id", handlers.GetTicketHandler())
-		api.GET("/locations", handlers.GetLocationsHandler())
+		api.POST("/ticket", auth, idempotent, handlers.CreateTicketHandler(redisService, store, gateService))
+		api.POST("/ticket/preopen", auth, idempotent, handlers.PreOpenTicketHandler(redisService, store, gateService))
+		api.GET("/ticket/:id", auth, handlers.GetTicketHandler(store, ticketWriter))
+		api.GET("/me/tickets", auth, handlers.MyTicketsHandler(store, ticketWriter))
+		api.GET("/ticket/:id/qr", auth, handlers.TicketQRHandler(store, ticketWriter, ticketPassService))
+		api.DELETE("/ticket/:id", auth, handlers.CancelTicketHandler(redisService, store, ticketWriter, waitlistService))
+		api.GET("/locations", handlers.GetLocationsHandler(redisService, store))
+
+		// Waitlist for sold-out slots
+		api.POST("/waitlist", auth, handlers.JoinWaitlistHandler(redisService, store, waitlistService))
+		api.GET("/waitlist", auth, handlers.MyWaitlistHandler(waitlistService))
+		api.DELETE("/waitlist", auth, handlers.LeaveWaitlistHandler(store, waitlistService))
+		api.POST("/waitlist/offers/:id/claim", auth, handlers.ClaimWaitlistOfferHandler(waitlistService))
+		api.DELETE("/waitlist/offers/:id", auth, handlers.DeclineWaitlistOfferHandler(waitlistService))
+
+		// Admin: location catalog
+		admin := api.Group("/admin", auth, handlers.RequireRole(models.RoleAdmin))
+		admin.GET("/locations", handlers.AdminListLocationsHandler(redisService, store))
+		admin.POST("/locations", handlers.AdminCreateLocationHandler(redisService, store))
+		admin.PATCH("/locations/:id", handlers.AdminUpdateLocationHandler(store))
+		admin.PUT("/locations/:id/quota", handlers.AdminSetLocationQuotaHandler(redisService, store, waitlistService))
+		admin.POST("/locations/:id/quota/reset", handlers.AdminResetLocationQuotaHandler(redisService, store))
+		admin.PUT("/locations/:id/enabled", handlers.AdminSetLocationEnabledHandler(store))
+		admin.PUT("/locations/:id/slots", handlers.AdminSetLocationSlotsHandler(redisService, store, waitlistService))
+		admin.PUT("/locations/:id/gate", handlers.AdminSetLocationGateHandler(store))
+		admin.POST("/gate/bypass", handlers.AdminIssueGateBypassHandler(store, bypassService))
+		admin.PUT("/users/:id/role", handlers.AdminSetUserRoleHandler(store))
+
+		// Staff: door check-in
+		staff := api.Group("/staff", auth, handlers.RequireRole(models.RoleStaff, models.RoleAdmin))
+		staff.POST("/checkin", handlers.CheckInHandler(store, ticketWriter, ticketPassService))
+		staff.POST("/tickets/:id/no-show", handlers.MarkNoShowHandler(store))
 
 		if ragService != nil {
 			api.POST("/chat", handlers.ChatHandler(ragService))
@@ -72,7 +145,6 @@ func main() {
 	}
 
 	log.Println("Server starting")
-	log.Println("Database: database.json")
 	log.Println("Endpoints available")
 	addr := strings.TrimSpace(os.Getenv("SERVER_ADDR"))
 	if addr == "" {
@@ -87,5 +159,32 @@ func main() {
 		}
 	}
 	log.Printf("Listening on %s", addr)
-	r.Run(addr)
+
+	srv := &http.Server{Addr: addr, Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	// Shut down on SIGINT/SIGTERM: finish in-flight requests, stop the
+	// background workers, then write out the store.
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	<-stop.Done()
+	log.Println("Shutting down")
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown: %v", err)
+	}
+	queueService.Stop()
+	gateService.Stop()
+	waitlistService.Stop()
+	reconciler.Stop()
+	ticketWriter.Stop()
+	if err := store.Close(); err != nil {
+		log.Printf("Store close failed: %v", err)
+	}
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"war-ticket-engine/services"
+)
+
+// migrateCommand applies the pending store migrations, shows what they
+// would change without storing anything (-dry-run), or lists every
+// migration and whether it is applied (-report). It works on the store
+// the server would open, chosen by STORE_BACKEND.
+func migrateCommand(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "show what the pending migrations would change without storing it")
+	report := flags.Bool("report", false, "list all migrations and whether they are applied")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *dryRun && *report {
+		fmt.Fprintln(os.Stderr, "-dry-run and -report cannot be combined")
+		return 2
+	}
+
+	store, err := services.OpenStoreUnmigrated()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open store: %v\n", err)
+		return 1
+	}
+	// Read-only runs leave the store as it is: closing the JSON store
+	// would compact its log.
+	if !*dryRun && !*report {
+		defer func() {
+			if err := store.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "close store: %v\n", err)
+			}
+		}()
+	}
+
+	var statuses []services.MigrationStatus
+	if *report {
+		statuses, err = store.Migrations()
+	} else {
+		statuses, err = store.Migrate(*dryRun)
+	}
+	if len(statuses) > 0 {
+		printMigrations(os.Stdout, statuses, *dryRun)
+	} else if err == nil {
+		fmt.Printf("No pending migrations (schema version %d).\n", services.SchemaVersion)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func printMigrations(out io.Writer, statuses []services.MigrationStatus, dryRun bool) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tCHANGED\tDESCRIPTION")
+	for _, m := range statuses {
+		status := "pending"
+		switch {
+		case m.Applied && m.AppliedAt != nil:
+			status = "applied " + m.AppliedAt.Local().Format("2006-01-02 15:04")
+		case m.Applied:
+			status = "applied"
+		case dryRun:
+			status = "would apply"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n", m.Version, m.Name, status, m.Changed, m.Description)
+	}
+	w.Flush()
+}
@@ -1,21 +1,121 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Ticket statuses. A ticket is issued active and moves at most once, to
+// one of the final statuses, through Transition.
+const (
+	TicketActive    = "active"
+	TicketCancelled = "cancelled"
+	TicketRedeemed  = "redeemed"
+	TicketNoShow    = "no_show"
+	TicketExpired   = "expired"
+)
+
+var ErrInvalidTransition = errors.New("invalid ticket status transition")
+
+var ticketTransitions = map[string][]string{
+	TicketActive: {TicketCancelled, TicketRedeemed, TicketNoShow, TicketExpired},
+}
 
 type Ticket struct {
-	ID           string    `json:"id"`
-	UserID       string    `json:"user_id"`
-	LocationID   string    `json:"location_id"`
-	LocationName string    `json:"location_name"`
-	TicketNumber string    `json:"ticket_number"`
-	Code         string    `json:"code"`
-	TimeSlot     string    `json:"time_slot"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           string     `json:"id"`
+	UserID       string     `json:"user_id"`
+	LocationID   string     `json:"location_id"`
+	LocationName string     `json:"location_name"`
+	TicketNumber string     `json:"ticket_number"`
+	Code         string     `json:"code"`
+	TimeSlot     string     `json:"time_slot"`
+	Date         string     `json:"date"`
+	Status       string     `json:"status"`
+	CreatedAt    time.Time  `json:"created_at"`
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+	CancelledBy  string     `json:"cancelled_by,omitempty"`
+	RedeemedAt   *time.Time `json:"redeemed_at,omitempty"`
+	RedeemedBy   string     `json:"redeemed_by,omitempty"`
+	NoShowAt     *time.Time `json:"no_show_at,omitempty"`
+	NoShowBy     string     `json:"no_show_by,omitempty"`
+	ExpiredAt    *time.Time `json:"expired_at,omitempty"`
+}
+
+// CurrentStatus returns the ticket's status. Tickets stored before
+// statuses existed have an empty status and count as active.
+func (t Ticket) CurrentStatus() string {
+	if t.Status == "" {
+		return TicketActive
+	}
+	return t.Status
+}
+
+// Active reports whether the ticket can still be used or cancelled.
+func (t Ticket) Active() bool {
+	return t.CurrentStatus() == TicketActive
+}
+
+// CanTransition reports whether the ticket may move to status to.
+func (t Ticket) CanTransition(to string) bool {
+	for _, allowed := range ticketTransitions[t.CurrentStatus()] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the ticket to status to, recording when and by whom
+// (a user ID, empty for the system). It returns ErrInvalidTransition and
+// leaves the ticket unchanged when the move is not allowed.
+func (t *Ticket) Transition(to string, at time.Time, by string) error {
+	if !t.CanTransition(to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, t.CurrentStatus(), to)
+	}
+	switch to {
+	case TicketCancelled:
+		t.CancelledAt, t.CancelledBy = &at, by
+	case TicketRedeemed:
+		t.RedeemedAt, t.RedeemedBy = &at, by
+	case TicketNoShow:
+		t.NoShowAt, t.NoShowBy = &at, by
+	case TicketExpired:
+		t.ExpiredAt = &at
+	}
+	t.Status = to
+	return nil
 }
 
 type Location struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Quota int64  `json:"quota"`
-	Region string `json:"region"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Quota     int64      `json:"quota"`
+	Region    string     `json:"region"`
+	Enabled   bool       `json:"enabled"`
+	Slots     []TimeSlot `json:"slots"`
+	GateOpen  string     `json:"gate_open,omitempty"`
+	GateClose string     `json:"gate_close,omitempty"`
+	// QuotaResetAt is when the remaining quota was last refilled; only
+	// tickets issued since then count against it.
+	QuotaResetAt *time.Time `json:"quota_reset_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TimeSlot is a daily arrival window at a location. Start ("15:04") also
+// identifies the slot; Capacity applies to each date separately.
+type TimeSlot struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Capacity int64  `json:"capacity"`
+}
+
+func (l Location) Slot(start string) (TimeSlot, bool) {
+	for _, slot := range l.Slots {
+		if slot.Start == start {
+			return slot, true
+		}
+	}
+	return TimeSlot{}, false
 }
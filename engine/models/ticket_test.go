@@ -0,0 +1,84 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type transitionCase struct {
+	from string
+	to   string
+	ok   bool
+}
+
+func TestTicketTransition(t *testing.T) {
+	statuses := []string{TicketActive, TicketCancelled, TicketRedeemed, TicketNoShow, TicketExpired}
+	tests := []transitionCase{
+		{TicketActive, TicketCancelled, true},
+		{TicketActive, TicketRedeemed, true},
+		{TicketActive, TicketNoShow, true},
+		{TicketActive, TicketExpired, true},
+		{"", TicketRedeemed, true}, // stored before statuses existed
+		{TicketActive, TicketActive, false},
+		{TicketActive, "lost", false},
+	}
+	// Every final status is final.
+	for _, from := range statuses[1:] {
+		for _, to := range statuses {
+			tests = append(tests, transitionCase{from, to, false})
+		}
+	}
+
+	at := time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		ticket := Ticket{ID: "t1", Status: tt.from}
+		if got := ticket.CanTransition(tt.to); got != tt.ok {
+			t.Errorf("%q to %q: CanTransition = %v, want %v", tt.from, tt.to, got, tt.ok)
+		}
+		err := ticket.Transition(tt.to, at, "staff")
+		if !tt.ok {
+			if !errors.Is(err, ErrInvalidTransition) {
+				t.Errorf("%q to %q: Transition = %v, want ErrInvalidTransition", tt.from, tt.to, err)
+			}
+			if ticket.Status != tt.from {
+				t.Errorf("%q to %q: refused transition changed the status to %q", tt.from, tt.to, ticket.Status)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q to %q: Transition = %v", tt.from, tt.to, err)
+			continue
+		}
+		if ticket.Status != tt.to {
+			t.Errorf("%q to %q: status = %q", tt.from, tt.to, ticket.Status)
+		}
+	}
+}
+
+func TestTicketTransitionRecordsWhenAndWho(t *testing.T) {
+	at := time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		to     string
+		gotAt  func(Ticket) *time.Time
+		gotBy  func(Ticket) string
+		wantBy string
+	}{
+		{TicketCancelled, func(t Ticket) *time.Time { return t.CancelledAt }, func(t Ticket) string { return t.CancelledBy }, "u1"},
+		{TicketRedeemed, func(t Ticket) *time.Time { return t.RedeemedAt }, func(t Ticket) string { return t.RedeemedBy }, "u1"},
+		{TicketNoShow, func(t Ticket) *time.Time { return t.NoShowAt }, func(t Ticket) string { return t.NoShowBy }, "u1"},
+		{TicketExpired, func(t Ticket) *time.Time { return t.ExpiredAt }, func(Ticket) string { return "" }, ""},
+	}
+	for _, tt := range tests {
+		ticket := Ticket{Status: TicketActive}
+		if err := ticket.Transition(tt.to, at, "u1"); err != nil {
+			t.Fatalf("Transition to %q: %v", tt.to, err)
+		}
+		if got := tt.gotAt(ticket); got == nil || !got.Equal(at) {
+			t.Errorf("%q: recorded at %v, want %v", tt.to, got, at)
+		}
+		if got := tt.gotBy(ticket); got != tt.wantBy {
+			t.Errorf("%q: recorded by %q, want %q", tt.to, got, tt.wantBy)
+		}
+	}
+}
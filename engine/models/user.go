@@ -2,12 +2,22 @@ package models
 
 import "time"
 
+const (
+	RoleUser  = "user"
+	RoleStaff = "staff"
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	ID        string    `json:"id"`
-	NIK       string    `json:"nik"`
-	Nama      string    `json:"nama"`
-	Whatsapp  string    `json:"whatsapp"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password"` // Encrypted
-	CreatedAt time.Time `json:"created_at"`
+	ID       string `json:"id"`
+	NIK      string `json:"nik"`
+	Nama     string `json:"nama"`
+	Whatsapp string `json:"whatsapp"`
+	Email    string `json:"email"`
+	Password string `json:"password"` // Encrypted
+	Role     string `json:"role,omitempty"`
+	// LocationID is the boutique a staff member works at; check-ins
+	// and no-shows they record are limited to it.
+	LocationID string    `json:"location_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
 }
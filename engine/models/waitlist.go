@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// WaitlistEntry is a user waiting for a seat in one time slot of a
+// location on one date.
+type WaitlistEntry struct {
+	UserID     string    `json:"user_id"`
+	LocationID string    `json:"location_id"`
+	Date       string    `json:"date"`
+	TimeSlot   string    `json:"time_slot"`
+	JoinedAt   time.Time `json:"joined_at"`
+}
+
+// WaitlistOffer is a released seat held for a waitlisted user until
+// ExpiresAt. Claiming it issues a ticket with the offer's ID.
+type WaitlistOffer struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	LocationID string    `json:"location_id"`
+	Date       string    `json:"date"`
+	TimeSlot   string    `json:"time_slot"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+	"war-ticket-engine/models"
+)
+
+// Backup is a copy of everything a store holds, in a form either backend
+// can restore. It includes password hashes, so backup files are written
+// readable by their owner only.
+type Backup struct {
+	SchemaVersion int               `json:"schema_version"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Backend       string            `json:"backend"`
+	Users         []models.User     `json:"users"`
+	Tickets       []models.Ticket   `json:"tickets"`
+	Locations     []models.Location `json:"locations"`
+	Sequences     map[string]int64  `json:"sequences"`
+}
+
+// TakeBackup copies the configured store while the server may be using
+// it. The JSON files are only read, never locked or repaired; Postgres
+// is read in one repeatable-read transaction. Tickets still in the
+// TicketWriter queue are added, so a booking the server already
+// confirmed is not missing from the copy.
+func TakeBackup() (Backup, error) {
+	backup, err := backupStore()
+	if err != nil {
+		return Backup{}, err
+	}
+	queued, err := QueuedTickets()
+	if err != nil {
+		return Backup{}, fmt.Errorf("read ticket write queue: %w", err)
+	}
+	stored := make(map[string]bool, len(backup.Tickets))
+	for _, ticket := range backup.Tickets {
+		stored[ticket.ID] = true
+	}
+	for _, ticket := range queued {
+		if !stored[ticket.ID] {
+			stored[ticket.ID] = true
+			backup.Tickets = append(backup.Tickets, ticket)
+		}
+	}
+	sortBackup(&backup)
+	return backup, nil
+}
+
+// ResetCounters brings the shared Redis counters in line with a store
+// that was just restored. Slot, ticket number and holding counters are
+// dropped, then quota, slot and war counters are recomputed from the
+// restored tickets at once and the holdings are seeded again; ticket
+// numbers restart from the restored high-water marks. Without Redis
+// there is nothing to reset: in-memory counters are rebuilt when the
+// server starts.
+func ResetCounters(store Store) error {
+	redis := NewRedisService()
+	if !redis.IsConnected() {
+		return nil
+	}
+	defer redis.Client.Close()
+
+	for _, pattern := range []string{"slot_quota:*", "ticket_seq:*", "holding:*"} {
+		iter := redis.Client.Scan(ctx, 0, pattern, 500).Iterator()
+		for iter.Next(ctx) {
+			if err := redis.Client.Del(ctx, iter.Val()).Err(); err != nil {
+				return err
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+
+	reconciler := NewReconciler(redis, store, NewTicketWriter(redis, store))
+	now := time.Now()
+	if err := reconciler.Reconcile(now, true); err != nil {
+		return err
+	}
+	return reconciler.seedHoldings(now)
+}
+
+func backupStore() (Backup, error) {
+	backend, target, err := storeConfig()
+	if err != nil {
+		return Backup{}, err
+	}
+	if backend == "json" {
+		return readJSONBackup(target)
+	}
+	store, err := NewPostgresStore(target)
+	if err != nil {
+		return Backup{}, err
+	}
+	defer store.Close()
+	return store.Backup()
+}
+
+// readJSONBackup loads the snapshot and log of a JSON store that another
+// process may be writing. A compaction that replaces the snapshot during
+// the read can pair the old snapshot with an already emptied log, so the
+// read is repeated until the snapshot stayed in place throughout.
+func readJSONBackup(path string) (Backup, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		before, err := statIfExists(path)
+		if err != nil {
+			return Backup{}, err
+		}
+		db := newJSONStore(path)
+		db.readOnly = true
+		if err := db.Load(); err != nil {
+			return Backup{}, err
+		}
+		after, err := statIfExists(path)
+		if err != nil {
+			return Backup{}, err
+		}
+		if sameFile(before, after) {
+			return db.Backup()
+		}
+	}
+	return Backup{}, fmt.Errorf("%s kept changing during the backup", path)
+}
+
+func statIfExists(path string) (os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return info, err
+}
+
+func sameFile(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
+
+// ReadBackup reads a backup file, upgrading its records when it was
+// taken by an older schema.
+func ReadBackup(path string) (Backup, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Backup{}, err
+	}
+	var backup Backup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return Backup{}, err
+	}
+	if backup.SchemaVersion > SchemaVersion {
+		return Backup{}, newerSchemaError(backup.SchemaVersion)
+	}
+	if backup.SchemaVersion < SchemaVersion {
+		var raw struct {
+			Users     []map[string]any `json:"users"`
+			Tickets   []map[string]any `json:"tickets"`
+			Locations []map[string]any `json:"locations"`
+		}
+		if err := decodeRaw(data, &raw); err != nil {
+			return Backup{}, err
+		}
+		changed := make(map[int]int)
+		for _, user := range raw.Users {
+			upgradeRecords("user", user, backup.SchemaVersion, changed)
+		}
+		for _, ticket := range raw.Tickets {
+			upgradeRecords("ticket", ticket, backup.SchemaVersion, changed)
+		}
+		for _, location := range raw.Locations {
+			upgradeRecords("location", location, backup.SchemaVersion, changed)
+		}
+		upgraded, err := json.Marshal(raw)
+		if err != nil {
+			return Backup{}, err
+		}
+		if err := json.Unmarshal(upgraded, &backup); err != nil {
+			return Backup{}, err
+		}
+		backup.SchemaVersion = SchemaVersion
+	}
+	return backup, nil
+}
+
+// WriteFile writes the backup to path atomically.
+func (b Backup) WriteFile(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// sortBackup orders users and tickets by creation and locations by ID,
+// so backups of the same data compare equal.
+func sortBackup(b *Backup) {
+	sort.Slice(b.Users, func(i, j int) bool {
+		if !b.Users[i].CreatedAt.Equal(b.Users[j].CreatedAt) {
+			return b.Users[i].CreatedAt.Before(b.Users[j].CreatedAt)
+		}
+		return b.Users[i].ID < b.Users[j].ID
+	})
+	sort.Slice(b.Tickets, func(i, j int) bool {
+		if !b.Tickets[i].CreatedAt.Equal(b.Tickets[j].CreatedAt) {
+			return b.Tickets[i].CreatedAt.Before(b.Tickets[j].CreatedAt)
+		}
+		return b.Tickets[i].ID < b.Tickets[j].ID
+	})
+	sort.Slice(b.Locations, func(i, j int) bool { return b.Locations[i].ID < b.Locations[j].ID })
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBypassInvalid  = errors.New("bypass token invalid")
+	ErrBypassExpired  = errors.New("bypass token outside validity window")
+	ErrBypassScope    = errors.New("bypass token not valid for location")
+	ErrBypassTooLong  = errors.New("bypass validity window too long")
+	ErrBypassNoTarget = errors.New("bypass token needs at least one location")
+)
+
+const (
+	AuditBypassIssued   = "bypass_issued"
+	AuditBypassUsed     = "bypass_used"
+	AuditBypassRejected = "bypass_rejected"
+)
+
+// BypassService issues and verifies the QA/audit whitelist tokens that
+// let a request through a closed gate. Tokens are signed like captcha
+// tokens, list the locations they cover and carry their own validity
+// window, so no server state is needed to check them. Every issue, use
+// and rejected attempt is appended to the audit log.
+type BypassService struct {
+	signer    tokenSigner
+	maxWindow time.Duration
+	auditPath string
+
+	mu sync.Mutex
+}
+
+// BypassGrant is the decoded content of a bypass token.
+type BypassGrant struct {
+	ID          string    `json:"id"`
+	IssuedBy    string    `json:"issued_by"`
+	LocationIDs []string  `json:"location_ids"`
+	ValidFrom   time.Time `json:"valid_from"`
+	ValidUntil  time.Time `json:"valid_until"`
+}
+
+// AuditEntry is one line of the gate audit log.
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	TokenID    string    `json:"token_id,omitempty"`
+	IssuedBy   string    `json:"issued_by,omitempty"`
+	Actor      string    `json:"actor,omitempty"`
+	LocationID string    `json:"location_id,omitempty"`
+	Scope      []string  `json:"scope,omitempty"`
+	ValidFrom  time.Time `json:"valid_from,omitzero"`
+	ValidUntil time.Time `json:"valid_until,omitzero"`
+	Gate       string    `json:"gate,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Note       string    `json:"note,omitempty"`
+}
+
+func NewBypassService() *BypassService {
+	secret := readSecret("GATE_BYPASS_SECRET")
+	auditPath := strings.TrimSpace(os.Getenv("GATE_AUDIT_LOG"))
+	if auditPath == "" {
+		auditPath = "gate_audit.log"
+	}
+
+	return &BypassService{
+		signer:    newTokenSigner(secret),
+		maxWindow: readSeconds("GATE_BYPASS_MAX_SECONDS", 24*3600),
+		auditPath: auditPath,
+	}
+}
+
+// Issue signs a bypass token for the given locations, valid between from
+// and until.
+func (b *BypassService) Issue(issuedBy string, locationIDs []string, from, until time.Time, note string) (BypassGrant, string, error) {
+	if len(locationIDs) == 0 {
+		return BypassGrant{}, "", ErrBypassNoTarget
+	}
+	if !until.After(from) || until.Sub(from) > b.maxWindow {
+		return BypassGrant{}, "", ErrBypassTooLong
+	}
+	if strings.ContainsAny(issuedBy, ",;|") {
+		return BypassGrant{}, "", ErrBypassInvalid
+	}
+	for _, id := range locationIDs {
+		if id == "" || strings.ContainsAny(id, ",;|") {
+			return BypassGrant{}, "", ErrBypassInvalid
+		}
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return BypassGrant{}, "", err
+	}
+	grant := BypassGrant{
+		ID:          id,
+		IssuedBy:    issuedBy,
+		LocationIDs: locationIDs,
+		ValidFrom:   from.Truncate(time.Second),
+		ValidUntil:  until.Truncate(time.Second),
+	}
+	data := strings.Join([]string{
+		grant.ID,
+		grant.IssuedBy,
+		strconv.FormatInt(grant.ValidFrom.Unix(), 10),
+		strings.Join(grant.LocationIDs, ";"),
+	}, ",")
+	token := b.signer.sign(grant.ValidUntil.Unix(), "gate_bypass", data)
+
+	b.Audit(AuditEntry{
+		Event:      AuditBypassIssued,
+		TokenID:    grant.ID,
+		IssuedBy:   grant.IssuedBy,
+		Scope:      grant.LocationIDs,
+		ValidFrom:  grant.ValidFrom,
+		ValidUntil: grant.ValidUntil,
+		Note:       note,
+	})
+	return grant, token, nil
+}
+
+// Verify checks that token is authentic, inside its validity window and
+// covers locationID.
+func (b *BypassService) Verify(token, locationID string, now time.Time) (BypassGrant, error) {
+	grant, err := b.parse(token)
+	if err != nil {
+		return grant, err
+	}
+	if now.Before(grant.ValidFrom) || now.After(grant.ValidUntil) {
+		return grant, ErrBypassExpired
+	}
+	if !slices.Contains(grant.LocationIDs, locationID) {
+		return grant, ErrBypassScope
+	}
+	return grant, nil
+}
+
+func (b *BypassService) parse(token string) (BypassGrant, error) {
+	exp, kind, data, err := b.signer.parse(token)
+	if err != nil || kind != "gate_bypass" {
+		return BypassGrant{}, ErrBypassInvalid
+	}
+	parts := strings.Split(data, ",")
+	if len(parts) != 4 {
+		return BypassGrant{}, ErrBypassInvalid
+	}
+	from, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return BypassGrant{}, ErrBypassInvalid
+	}
+	return BypassGrant{
+		ID:          parts[0],
+		IssuedBy:    parts[1],
+		LocationIDs: strings.Split(parts[3], ";"),
+		ValidFrom:   time.Unix(from, 0),
+		ValidUntil:  time.Unix(exp, 0),
+	}, nil
+}
+
+// Audit appends an entry to the audit log file and mirrors it to the
+// process log, so a failing disk does not lose the trail entirely.
+func (b *BypassService) Audit(entry AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("audit encode failed: %v", err)
+		return
+	}
+	log.Printf("AUDIT %s", line)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f, err := os.OpenFile(b.auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("audit write failed: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("audit write failed: %v", err)
+	}
+}
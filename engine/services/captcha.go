@@ -1,10 +1,7 @@
 package services
 
 import (
-	"crypto/hmac"
 	"crypto/rand"
-	"crypto/sha256"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"math/big"
@@ -15,7 +12,7 @@ import (
 )
 
 type CaptchaService struct {
-	secret    []byte
+	signer    tokenSigner
 	ttl       time.Duration
 	imageSets []imageChallenge
 }
@@ -41,10 +38,7 @@ type imageChallenge struct {
 }
 
 func NewCaptchaService() *CaptchaService {
-	secret := strings.TrimSpace(os.Getenv("CAPTCHA_SECRET"))
-	if secret == "" {
-		secret = "dev-secret"
-	}
+	secret := readSecret("CAPTCHA_SECRET")
 
 	ttlSeconds := int64(300)
 	if raw := strings.TrimSpace(os.Getenv("CAPTCHA_TTL_SECONDS")); raw != "" {
@@ -54,7 +48,7 @@ func NewCaptchaService() *CaptchaService {
 	}
 
 	return &CaptchaService{
-		secret: []byte(secret),
+		signer: newTokenSigner(secret),
 		ttl:    time.Duration(ttlSeconds) * time.Second,
 		imageSets: []imageChallenge{
 			{
@@ -182,38 +176,14 @@ func (c *CaptchaService) ValidateImage(token, answer string) error {
 }
 
 func (c *CaptchaService) signToken(exp int64, kind, data string) string {
-	payload := fmt.Sprintf("%d|%s|%s", exp, kind, data)
-	mac := hmac.New(sha256.New, c.secret)
-	mac.Write([]byte(payload))
-	sig := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
-	token := payload + "|" + sig
-	return base64.RawURLEncoding.EncodeToString([]byte(token))
+	return c.signer.sign(exp, kind, data)
 }
 
 func (c *CaptchaService) parseToken(token string) (int64, string, string, error) {
-	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(token))
+	exp, kind, data, err := c.signer.parse(token)
 	if err != nil {
 		return 0, "", "", errors.New("invalid captcha token")
 	}
-	parts := strings.Split(string(raw), "|")
-	if len(parts) != 4 {
-		return 0, "", "", errors.New("invalid captcha token")
-	}
-	exp, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil {
-		return 0, "", "", errors.New("invalid captcha token")
-	}
-	kind := parts[1]
-	data := parts[2]
-	sig := parts[3]
-
-	payload := fmt.Sprintf("%d|%s|%s", exp, kind, data)
-	mac := hmac.New(sha256.New, c.secret)
-	mac.Write([]byte(payload))
-	expected := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
-	if !hmac.Equal([]byte(expected), []byte(sig)) {
-		return 0, "", "", errors.New("invalid captcha token")
-	}
 	return exp, kind, data, nil
 }
 
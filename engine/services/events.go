@@ -0,0 +1,177 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	EventQuota = "quota"
+	EventGate  = "gate"
+	EventQueue = "queue"
+
+	eventsChannel = "engine:events"
+	eventsSeqKey  = "events:seq"
+	eventHistory  = 1024
+	eventOutbox   = 1024
+)
+
+// Event is one message of the live update stream. IDs increase
+// monotonically (cluster-wide when Redis is connected) so SSE clients
+// can resume with Last-Event-ID.
+type Event struct {
+	ID   int64           `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type QuotaEvent struct {
+	LocationID    string `json:"location_id"`
+	Remaining     int64  `json:"remaining"`
+	Date          string `json:"date,omitempty"`
+	Slot          string `json:"slot,omitempty"`
+	SlotRemaining *int64 `json:"slot_remaining,omitempty"`
+}
+
+type QueueEvent struct {
+	Admitted int64 `json:"admitted"`
+}
+
+// EventBroker fans events out to local subscribers. With Redis
+// connected every publish goes through a pub/sub channel, so clients of
+// any replica see changes made on all of them.
+type EventBroker struct {
+	redis   *RedisService
+	mu      sync.Mutex
+	nextID  int64
+	history []Event
+	subs    map[chan Event]struct{}
+
+	// outbox holds events waiting to be sent to Redis; dropped counts
+	// those that did not fit.
+	outbox  chan outgoingEvent
+	dropped atomic.Int64
+}
+
+type outgoingEvent struct {
+	kind    string
+	payload json.RawMessage
+}
+
+func newEventBroker(redis *RedisService) *EventBroker {
+	b := &EventBroker{
+		redis: redis,
+		subs:  make(map[chan Event]struct{}),
+	}
+	if redis.connected {
+		b.outbox = make(chan outgoingEvent, eventOutbox)
+		go b.send()
+		go b.listen()
+	}
+	return b
+}
+
+// Publish sends an event to all subscribers. It never waits on Redis:
+// events are handed to a background sender and dropped when it falls
+// behind, since live updates are best effort. Failures are logged.
+func (b *EventBroker) Publish(kind string, data any) {
+	if b == nil {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("event encode failed: %v", err)
+		return
+	}
+
+	if b.outbox != nil {
+		select {
+		case b.outbox <- outgoingEvent{kind: kind, payload: payload}:
+		default:
+			b.dropped.Add(1)
+		}
+		return
+	}
+
+	b.mu.Lock()
+	b.nextID++
+	event := Event{ID: b.nextID, Type: kind, Data: payload}
+	b.mu.Unlock()
+	b.dispatch(event)
+}
+
+// Subscribe returns a channel of new events plus the buffered events
+// after lastID, for clients resuming a stream. cancel must be called
+// when the subscriber goes away.
+func (b *EventBroker) Subscribe(lastID int64) (<-chan Event, []Event, func()) {
+	ch := make(chan Event, 64)
+
+	b.mu.Lock()
+	var backlog []Event
+	if lastID > 0 {
+		for _, event := range b.history {
+			if event.ID > lastID {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+	return ch, backlog, cancel
+}
+
+func (b *EventBroker) dispatch(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.history = append(b.history, event)
+	if len(b.history) > eventHistory {
+		b.history = b.history[len(b.history)-eventHistory:]
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			// Slow subscriber: drop rather than stall publishers. The
+			// client catches up with the next event or a reconnect.
+		}
+	}
+}
+
+// send numbers queued events and publishes them to Redis.
+func (b *EventBroker) send() {
+	for event := range b.outbox {
+		if n := b.dropped.Swap(0); n > 0 {
+			log.Printf("event publish buffer full, %d events dropped", n)
+		}
+		id, err := b.redis.Client.Incr(ctx, eventsSeqKey).Result()
+		if err != nil {
+			log.Printf("event publish failed: %v", err)
+			continue
+		}
+		raw, _ := json.Marshal(Event{ID: id, Type: event.kind, Data: event.payload})
+		if err := b.redis.Client.Publish(ctx, eventsChannel, raw).Err(); err != nil {
+			log.Printf("event publish failed: %v", err)
+		}
+	}
+}
+
+func (b *EventBroker) listen() {
+	sub := b.redis.Client.Subscribe(ctx, eventsChannel)
+	for msg := range sub.Channel() {
+		var event Event
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			log.Printf("event decode failed: %v", err)
+			continue
+		}
+		b.dispatch(event)
+	}
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventPublishDropsWhenSenderFallsBehind(t *testing.T) {
+	// A broker whose Redis sender is stuck: nothing drains the outbox.
+	b := newEventBroker(newTestRedis())
+	b.outbox = make(chan outgoingEvent, 2)
+
+	done := make(chan struct{})
+	go func() {
+		for range 5 {
+			b.Publish(EventQuota, QuotaEvent{LocationID: "juanda", Remaining: 1})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish waited for the Redis sender")
+	}
+	if got := len(b.outbox); got != 2 {
+		t.Errorf("%d events queued, want the outbox size 2", got)
+	}
+	if got := b.dropped.Load(); got != 3 {
+		t.Errorf("%d events dropped, want 3", got)
+	}
+}
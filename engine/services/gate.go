@@ -0,0 +1,236 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrGateNotOpen    = errors.New("gate not open yet")
+	ErrGateClosed     = errors.New("gate closed")
+	ErrPreOpenEnded   = errors.New("pre-open window ended")
+	ErrInvalidGateCfg = errors.New("invalid gate time")
+)
+
+const (
+	GateBeforeOpen = "before_open"
+	GatePreOpen    = "pre_open"
+	GateOpen       = "open"
+	GateClosed     = "closed"
+)
+
+// GateService decides when bookings are accepted. Every day the gate
+// opens at GATE_START_TIME and closes at GATE_CLOSE_TIME (empty means
+// open until midnight), with a pre-open window of PREOPEN_OFFSET_MINUTES
+// before opening. Locations can override open/close times. The server
+// clock is authoritative; client-supplied times are never consulted.
+type GateService struct {
+	openAt  string
+	closeAt string
+	preOpen time.Duration
+	store   Store
+	events  *EventBroker
+	bypass  *BypassService
+	stop    chan struct{}
+
+	mu    sync.Mutex
+	state map[string]string
+}
+
+type GateStatus struct {
+	LocationID string    `json:"location_id"`
+	State      string    `json:"state"`
+	PreOpenAt  time.Time `json:"pre_open_at"`
+	OpensAt    time.Time `json:"opens_at"`
+	ClosesAt   time.Time `json:"closes_at,omitzero"`
+}
+
+func NewGateService(redis *RedisService, store Store, bypass *BypassService) *GateService {
+	openAt := strings.TrimSpace(os.Getenv("GATE_START_TIME"))
+	if openAt == "" {
+		openAt = "07:00"
+	}
+	if _, err := time.Parse("15:04", openAt); err != nil {
+		log.Printf("Invalid GATE_START_TIME %q, using 07:00", openAt)
+		openAt = "07:00"
+	}
+	closeAt := strings.TrimSpace(os.Getenv("GATE_CLOSE_TIME"))
+	if _, err := time.Parse("15:04", closeAt); closeAt != "" && err != nil {
+		log.Printf("Invalid GATE_CLOSE_TIME %q, gate stays open until midnight", closeAt)
+		closeAt = ""
+	}
+
+	offsetMinutes := 10
+	if raw := strings.TrimSpace(os.Getenv("PREOPEN_OFFSET_MINUTES")); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			offsetMinutes = v
+		}
+	}
+
+	return &GateService{
+		openAt:  openAt,
+		closeAt: closeAt,
+		preOpen: time.Duration(offsetMinutes) * time.Minute,
+		store:   store,
+		events:  redis.Events,
+		bypass:  bypass,
+		state:   make(map[string]string),
+	}
+}
+
+// ValidateGateTimes checks a per-location override. Empty values fall
+// back to the global schedule.
+func ValidateGateTimes(openAt, closeAt string) error {
+	var open, close time.Time
+	var err error
+	if openAt != "" {
+		if open, err = time.Parse("15:04", openAt); err != nil {
+			return ErrInvalidGateCfg
+		}
+	}
+	if closeAt != "" {
+		if close, err = time.Parse("15:04", closeAt); err != nil {
+			return ErrInvalidGateCfg
+		}
+	}
+	if openAt != "" && closeAt != "" && !close.After(open) {
+		return ErrInvalidGateCfg
+	}
+	return nil
+}
+
+// Status computes the gate state of a location (or the global gate for
+// an unknown ID such as WarQuotaID) at the given time.
+func (g *GateService) Status(locationID string, now time.Time) GateStatus {
+	openAt, closeAt := g.openAt, g.closeAt
+	if loc, exists := g.store.GetLocation(locationID); exists {
+		if loc.GateOpen != "" {
+			openAt = loc.GateOpen
+		}
+		if loc.GateClose != "" {
+			closeAt = loc.GateClose
+		}
+	}
+
+	status := GateStatus{LocationID: locationID}
+	status.OpensAt = atClock(now, openAt)
+	status.PreOpenAt = status.OpensAt.Add(-g.preOpen)
+	if closeAt != "" {
+		status.ClosesAt = atClock(now, closeAt)
+	}
+
+	switch {
+	case now.Before(status.PreOpenAt):
+		status.State = GateBeforeOpen
+	case now.Before(status.OpensAt):
+		status.State = GatePreOpen
+	case !status.ClosesAt.IsZero() && !now.Before(status.ClosesAt):
+		status.State = GateClosed
+	default:
+		status.State = GateOpen
+	}
+	return status
+}
+
+// Check returns nil when regular bookings are accepted.
+func (g *GateService) Check(locationID string, now time.Time) (GateStatus, error) {
+	status := g.Status(locationID, now)
+	switch status.State {
+	case GateOpen:
+		return status, nil
+	case GateClosed:
+		return status, ErrGateClosed
+	default:
+		return status, ErrGateNotOpen
+	}
+}
+
+// CheckPreOpen returns nil inside the pre-open window only.
+func (g *GateService) CheckPreOpen(locationID string, now time.Time) (GateStatus, error) {
+	status := g.Status(locationID, now)
+	switch status.State {
+	case GatePreOpen:
+		return status, nil
+	case GateBeforeOpen:
+		return status, ErrGateNotOpen
+	case GateClosed:
+		return status, ErrGateClosed
+	default:
+		return status, ErrPreOpenEnded
+	}
+}
+
+// Bypass lets a QA/audit token through a closed gate for locationID.
+// The attempt is written to the audit log whether or not it succeeds;
+// entry carries the caller details (actor, IP, path) to record.
+func (g *GateService) Bypass(token, locationID string, now time.Time, entry AuditEntry) (BypassGrant, error) {
+	grant, err := g.bypass.Verify(token, locationID, now)
+
+	entry.Time = now
+	entry.TokenID = grant.ID
+	entry.IssuedBy = grant.IssuedBy
+	entry.LocationID = locationID
+	entry.Gate = g.Status(locationID, now).State
+	entry.Event = AuditBypassUsed
+	if err != nil {
+		entry.Event = AuditBypassRejected
+		entry.Note = err.Error()
+	}
+	g.bypass.Audit(entry)
+	return grant, err
+}
+
+// Start publishes a gate event whenever the global gate or a location's
+// gate changes state, until Stop is called.
+func (g *GateService) Start() {
+	g.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-g.stop:
+				return
+			case now := <-ticker.C:
+				g.publishChanges(now)
+			}
+		}
+	}()
+}
+
+func (g *GateService) Stop() {
+	if g.stop != nil {
+		close(g.stop)
+	}
+}
+
+func (g *GateService) publishChanges(now time.Time) {
+	ids := []string{WarQuotaID}
+	for _, loc := range g.store.ListLocations() {
+		ids = append(ids, loc.ID)
+	}
+
+	for _, id := range ids {
+		status := g.Status(id, now)
+		g.mu.Lock()
+		previous, seen := g.state[id]
+		g.state[id] = status.State
+		g.mu.Unlock()
+		if seen && previous != status.State {
+			g.events.Publish(EventGate, status)
+		}
+	}
+}
+
+func atClock(day time.Time, clock string) time.Time {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location())
+}
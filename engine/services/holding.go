@@ -0,0 +1,218 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"war-ticket-engine/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrAlreadyBooked = errors.New("already booked")
+
+// HoldingLimits caps how many tickets a single NIK may hold on one day,
+// across all locations and within a single location.
+type HoldingLimits struct {
+	PerDay      int64
+	PerLocation int64
+}
+
+// Holdings are kept until a day after the visit date has passed, so a
+// booking made days ahead still counts against the limits on the day.
+const holdingGrace = 24 * time.Hour
+
+// ReadHoldingLimits reads MAX_TICKETS_PER_NIK_PER_DAY (default 1) and
+// MAX_TICKETS_PER_NIK_PER_LOCATION (default: the per-day limit).
+func ReadHoldingLimits() HoldingLimits {
+	limits := HoldingLimits{
+		PerDay: readPositiveInt("MAX_TICKETS_PER_NIK_PER_DAY", 1),
+	}
+	limits.PerLocation = readPositiveInt("MAX_TICKETS_PER_NIK_PER_LOCATION", limits.PerDay)
+	return limits
+}
+
+func readPositiveInt(key string, fallback int64) int64 {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	val, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || val <= 0 {
+		return fallback
+	}
+	return val
+}
+
+// Both counters are checked and incremented in one script so two
+// concurrent bookings for the same NIK cannot both pass the check.
+var acquireHoldingScript = redis.NewScript(`
+local day = tonumber(redis.call('GET', KEYS[1]) or '0')
+local loc = tonumber(redis.call('GET', KEYS[2]) or '0')
+if day >= tonumber(ARGV[1]) or loc >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+redis.call('INCR', KEYS[2])
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+return 1
+`)
+
+var releaseHoldingScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if tonumber(redis.call('GET', key) or '0') > 0 then
+		redis.call('DECR', key)
+	end
+end
+return 1
+`)
+
+// raiseHoldingScript lifts a counter to at least ARGV[1], never lowering
+// one that bookings in flight have already taken further.
+var raiseHoldingScript = redis.NewScript(`
+if tonumber(redis.call('GET', KEYS[1]) or '0') < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+end
+return 1
+`)
+
+func holdingKeys(nik, locationID string, day time.Time) (string, string) {
+	dayKey := "holding:" + day.Format("2006-01-02") + ":" + nik
+	return dayKey, dayKey + ":" + locationID
+}
+
+// holdingTTL keeps a holding until holdingGrace after the end of its
+// visit date.
+func holdingTTL(day time.Time) time.Duration {
+	end := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location())
+	return max(time.Until(end), 0) + holdingGrace
+}
+
+// pruneHoldings drops fallback counters whose visit date has passed. It
+// runs at most once a day. Callers must hold s.mu.
+func (s *RedisService) pruneHoldings() {
+	today := time.Now().Format("2006-01-02")
+	if s.holdings == nil {
+		s.holdings = make(map[string]int64)
+	}
+	if s.holdingsPruned == today {
+		return
+	}
+	for key := range s.holdings {
+		// key is holding:<date>:<nik>[:<location>]
+		if date := strings.TrimPrefix(key, "holding:"); len(date) >= 10 && date[:10] < today {
+			delete(s.holdings, key)
+		}
+	}
+	s.holdingsPruned = today
+}
+
+// AcquireHolding reserves one holding slot for the NIK on the given day
+// and location. It returns ErrAlreadyBooked when either limit is reached.
+func (s *RedisService) AcquireHolding(nik, locationID string, day time.Time, limits HoldingLimits) error {
+	dayKey, locKey := holdingKeys(nik, locationID, day)
+
+	if s.connected {
+		ok, err := acquireHoldingScript.Run(ctx, s.Client, []string{dayKey, locKey},
+			limits.PerDay, limits.PerLocation, int64(holdingTTL(day).Seconds())).Int()
+		if err != nil {
+			return err
+		}
+		if ok == 0 {
+			return ErrAlreadyBooked
+		}
+		return nil
+	}
+
+	// Fallback: in-memory counters per visit date
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneHoldings()
+	if s.holdings[dayKey] >= limits.PerDay || s.holdings[locKey] >= limits.PerLocation {
+		return ErrAlreadyBooked
+	}
+	s.holdings[dayKey]++
+	s.holdings[locKey]++
+	return nil
+}
+
+// SeedHoldings counts the tickets each NIK already holds for today and
+// later dates, from the stored tickets and the reservations not yet
+// backed by one, and raises the holding counters to match. Counters are
+// only ever raised, so it is safe while bookings are running; it repairs
+// holdings lost with the in-memory fallback or a flushed Redis.
+func (s *RedisService) SeedHoldings(store Store, tickets []models.Ticket, reservations []Reservation, now time.Time) error {
+	today := now.Format("2006-01-02")
+	counts := make(map[string]int64)
+	days := make(map[string]time.Time)
+	hold := func(nik, scope, date string) {
+		if nik == "" || scope == "" || date < today {
+			return
+		}
+		day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			return
+		}
+		dayKey, locKey := holdingKeys(nik, scope, day)
+		counts[dayKey]++
+		counts[locKey]++
+		days[dayKey], days[locKey] = day, day
+	}
+	niks := make(map[string]string)
+	for _, ticket := range tickets {
+		if ticket.CurrentStatus() == models.TicketCancelled {
+			continue
+		}
+		nik, seen := niks[ticket.UserID]
+		if !seen {
+			user, _ := store.GetUser(ticket.UserID)
+			nik = user.NIK
+			niks[ticket.UserID] = nik
+		}
+		hold(nik, ticket.LocationID, ticket.Date)
+	}
+	for _, reservation := range reservations {
+		hold(reservation.NIK, reservation.HoldingScope, reservation.Date)
+	}
+
+	if s.connected {
+		for key, count := range counts {
+			ttl := int64(holdingTTL(days[key]).Seconds())
+			if err := raiseHoldingScript.Run(ctx, s.Client, []string{key}, count, ttl).Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneHoldings()
+	for key, count := range counts {
+		s.holdings[key] = max(s.holdings[key], count)
+	}
+	return nil
+}
+
+// ReleaseHolding gives back a slot taken by AcquireHolding, e.g. when
+// the booking fails afterwards.
+func (s *RedisService) ReleaseHolding(nik, locationID string, day time.Time) error {
+	dayKey, locKey := holdingKeys(nik, locationID, day)
+
+	if s.connected {
+		return releaseHoldingScript.Run(ctx, s.Client, []string{dayKey, locKey}).Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneHoldings()
+	for _, key := range []string{dayKey, locKey} {
+		if s.holdings[key] > 0 {
+			s.holdings[key]--
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"war-ticket-engine/models"
+)
+
+func TestFallbackHoldingsAreKeptPerVisitDate(t *testing.T) {
+	s := &RedisService{}
+	limits := HoldingLimits{PerDay: 1, PerLocation: 1}
+	dayA := time.Now().AddDate(0, 0, 1)
+	dayB := time.Now().AddDate(0, 0, 2)
+
+	if err := s.AcquireHolding("1", "juanda", dayA, limits); err != nil {
+		t.Fatalf("first booking for day A: %v", err)
+	}
+	if err := s.AcquireHolding("1", "juanda", dayB, limits); err != nil {
+		t.Fatalf("first booking for day B: %v", err)
+	}
+	if err := s.AcquireHolding("1", "juanda", dayA, limits); !errors.Is(err, ErrAlreadyBooked) {
+		t.Fatalf("second booking for day A = %v, want ErrAlreadyBooked", err)
+	}
+
+	if err := s.ReleaseHolding("1", "juanda", dayA); err != nil {
+		t.Fatalf("ReleaseHolding: %v", err)
+	}
+	if err := s.AcquireHolding("1", "juanda", dayA, limits); err != nil {
+		t.Fatalf("booking day A after release: %v", err)
+	}
+	if err := s.AcquireHolding("1", "juanda", dayB, limits); !errors.Is(err, ErrAlreadyBooked) {
+		t.Fatalf("second booking for day B = %v, want ErrAlreadyBooked", err)
+	}
+}
+
+func TestFallbackHoldingsDropPassedDates(t *testing.T) {
+	s := &RedisService{}
+	limits := HoldingLimits{PerDay: 1, PerLocation: 1}
+	yesterday := time.Now().AddDate(0, 0, -1)
+	if err := s.AcquireHolding("1", "juanda", yesterday, limits); err != nil {
+		t.Fatalf("AcquireHolding: %v", err)
+	}
+
+	s.holdingsPruned = ""
+	s.mu.Lock()
+	s.pruneHoldings()
+	left := len(s.holdings)
+	s.mu.Unlock()
+	if left != 0 {
+		t.Errorf("%d holdings left for a passed date, want 0", left)
+	}
+}
+
+func TestHoldingTTLOutlivesVisitDate(t *testing.T) {
+	for _, daysAhead := range []int{-1, 0, 1, 7, 30} {
+		day := time.Now().AddDate(0, 0, daysAhead)
+		end := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location())
+		if ttl := holdingTTL(day); time.Now().Add(ttl).Before(end) && daysAhead >= 0 {
+			t.Errorf("%d days ahead: TTL %v expires before the visit date ends", daysAhead, ttl)
+		}
+		if ttl := holdingTTL(day); ttl < holdingGrace {
+			t.Errorf("%d days ahead: TTL %v is shorter than the grace period", daysAhead, ttl)
+		}
+	}
+}
+
+func TestSeedHoldingsRestoresLimitsFromTickets(t *testing.T) {
+	db, _ := newTestJSONStore(t)
+	if err := db.SetUser(testUser("u1", "1")); err != nil {
+		t.Fatalf("SetUser: %v", err)
+	}
+	now := time.Now()
+	tomorrow := now.AddDate(0, 0, 1)
+	held := testTicket("t1", "u1")
+	held.Date = tomorrow.Format("2006-01-02")
+	cancelled := testTicket("t2", "u1")
+	cancelled.Date, cancelled.LocationID, cancelled.Status = held.Date, "tunjungan", models.TicketCancelled
+	past := testTicket("t3", "u1")
+	past.Date = now.AddDate(0, 0, -1).Format("2006-01-02")
+
+	s := &RedisService{}
+	limits := HoldingLimits{PerDay: 2, PerLocation: 1}
+	// A booking in flight holds its reservation while the seed runs.
+	if err := s.AcquireHolding("1", "galaxy", tomorrow, limits); err != nil {
+		t.Fatalf("AcquireHolding: %v", err)
+	}
+	inFlight := Reservation{TicketID: "t4", NIK: "1", LocationID: "galaxy", Date: held.Date, HoldingScope: "galaxy"}
+	tickets := []models.Ticket{held, cancelled, past}
+	if err := s.SeedHoldings(db, tickets, []Reservation{inFlight}, now); err != nil {
+		t.Fatalf("SeedHoldings: %v", err)
+	}
+
+	tests := []struct {
+		location string
+		day      time.Time
+		want     error
+	}{
+		{"juanda", tomorrow, ErrAlreadyBooked},    // held ticket
+		{"galaxy", tomorrow, ErrAlreadyBooked},    // reservation, counted once
+		{"tunjungan", tomorrow, ErrAlreadyBooked}, // daily limit: juanda + galaxy
+		{"juanda", now.AddDate(0, 0, -1), nil},    // passed dates are not seeded
+	}
+	for _, tt := range tests {
+		if err := s.AcquireHolding("1", tt.location, tt.day, limits); !errors.Is(err, tt.want) {
+			t.Errorf("AcquireHolding(%s, %s) = %v, want %v", tt.location, tt.day.Format("2006-01-02"), err, tt.want)
+		}
+	}
+}
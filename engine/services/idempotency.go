@@ -0,0 +1,151 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrIdempotencyInFlight = errors.New("request with this idempotency key still in progress")
+	ErrIdempotencyMismatch = errors.New("idempotency key reused with a different request")
+)
+
+// IdempotencyService remembers the response to a request carrying an
+// Idempotency-Key so a retry gets the same answer instead of booking a
+// second seat. Keys are scoped per user and endpoint and expire after
+// IDEMPOTENCY_TTL_SECONDS. A key is claimed before the handler runs, so
+// two concurrent retries cannot both get through.
+type IdempotencyService struct {
+	redis *RedisService
+	ttl   time.Duration
+
+	// Fallback state when Redis is unavailable
+	mu      sync.Mutex
+	entries map[string]idempotencyEntry
+}
+
+// StoredResponse is a replayable handler response.
+type StoredResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+type idempotencyEntry struct {
+	Fingerprint string          `json:"fingerprint"`
+	Response    *StoredResponse `json:"response,omitempty"`
+	ExpiresAt   time.Time       `json:"-"`
+}
+
+func NewIdempotencyService(redis *RedisService) *IdempotencyService {
+	return &IdempotencyService{
+		redis:   redis,
+		ttl:     readSeconds("IDEMPOTENCY_TTL_SECONDS", 24*3600),
+		entries: make(map[string]idempotencyEntry),
+	}
+}
+
+// Begin claims key for a new request. It returns the stored response when
+// the key was already completed, ErrIdempotencyInFlight while the first
+// request is still running and ErrIdempotencyMismatch when the key was
+// used for a different request body (fingerprint).
+func (s *IdempotencyService) Begin(key, fingerprint string) (*StoredResponse, error) {
+	pending := idempotencyEntry{Fingerprint: fingerprint}
+
+	if s.redis.IsConnected() {
+		raw, _ := json.Marshal(pending)
+		ok, err := s.redis.Client.SetNX(ctx, idempotencyKey(key), raw, s.ttl).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return nil, nil
+		}
+		stored, err := s.redis.Client.Get(ctx, idempotencyKey(key)).Bytes()
+		if err == redis.Nil {
+			// Expired or released between SETNX and GET; let the caller retry.
+			return nil, ErrIdempotencyInFlight
+		}
+		if err != nil {
+			return nil, err
+		}
+		var existing idempotencyEntry
+		if err := json.Unmarshal(stored, &existing); err != nil {
+			return nil, err
+		}
+		return existing.replay(fingerprint)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if existing, exists := s.entries[key]; exists && now.Before(existing.ExpiresAt) {
+		return existing.replay(fingerprint)
+	}
+	s.sweep(now)
+	pending.ExpiresAt = now.Add(s.ttl)
+	s.entries[key] = pending
+	return nil, nil
+}
+
+// Complete stores the response for a key claimed with Begin.
+func (s *IdempotencyService) Complete(key, fingerprint string, response StoredResponse) error {
+	entry := idempotencyEntry{Fingerprint: fingerprint, Response: &response}
+
+	if s.redis.IsConnected() {
+		raw, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return s.redis.Client.Set(ctx, idempotencyKey(key), raw, s.ttl).Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry.ExpiresAt = time.Now().Add(s.ttl)
+	s.entries[key] = entry
+	return nil
+}
+
+// Release drops a claimed key without a stored response, e.g. after a
+// server error, so the client can retry for real.
+func (s *IdempotencyService) Release(key string) error {
+	if s.redis.IsConnected() {
+		return s.redis.Client.Del(ctx, idempotencyKey(key)).Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (e idempotencyEntry) replay(fingerprint string) (*StoredResponse, error) {
+	if e.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyMismatch
+	}
+	if e.Response == nil {
+		return nil, ErrIdempotencyInFlight
+	}
+	return e.Response, nil
+}
+
+// sweep drops expired in-memory entries. Callers must hold s.mu.
+func (s *IdempotencyService) sweep(now time.Time) {
+	if len(s.entries) < 1024 {
+		return
+	}
+	for key, entry := range s.entries {
+		if !now.Before(entry.ExpiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func idempotencyKey(key string) string {
+	return "idempotency:" + key
+}
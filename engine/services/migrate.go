@@ -0,0 +1,150 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"war-ticket-engine/models"
+)
+
+// Migration upgrades stored data from schema Version-1 to Version. The
+// JSON store upgrades records one by one before decoding them, with the
+// function for their kind; each reports whether it changed the record
+// and must leave an already upgraded record alone. PostgreSQL runs
+// migrations/<version>_<name>.sql instead.
+type Migration struct {
+	Version     int
+	Name        string
+	Description string
+
+	user     func(record map[string]any) bool
+	ticket   func(record map[string]any) bool
+	location func(record map[string]any) bool
+}
+
+// migrations is the registry, in version order. Append only: a released
+// migration is never edited or renumbered.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Name:        "init",
+		Description: "users, tickets, locations and sequences",
+	},
+	{
+		Version:     2,
+		Name:        "ticket_status",
+		Description: "tickets stored before statuses existed get active or cancelled",
+		ticket:      upgradeTicketStatus,
+	},
+	{
+		Version:     3,
+		Name:        "ticket_date",
+		Description: "tickets stored before visit dates existed get the date they were issued",
+		ticket:      upgradeTicketDate,
+	},
+	{
+		Version:     4,
+		Name:        "user_role",
+		Description: "users stored before roles existed get the user role",
+		user:        upgradeUserRole,
+	},
+	{
+		Version:     5,
+		Name:        "location_quota_reset",
+		Description: "locations record when their remaining quota was last refilled",
+	},
+	{
+		Version:     6,
+		Name:        "user_location",
+		Description: "staff are assigned to the boutique they work at",
+	},
+}
+
+// SchemaVersion is the schema this build reads and writes. A store
+// holding data from a newer schema refuses to open.
+var SchemaVersion = migrations[len(migrations)-1].Version
+
+// MigrationStatus reports one migration against a store. Changed is the
+// number of records the migration changed, or would change in a dry run.
+type MigrationStatus struct {
+	Version     int        `json:"version"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Applied     bool       `json:"applied"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+	Changed     int        `json:"changed"`
+}
+
+func newerSchemaError(version int) error {
+	return fmt.Errorf("stored data has schema version %d, newer than this build (%d)", version, SchemaVersion)
+}
+
+// upgradeRecords applies the migrations after schema version from to one
+// raw JSON record of the given kind ("user", "ticket" or "location") and
+// counts the changes per migration version.
+func upgradeRecords(kind string, record map[string]any, from int, changed map[int]int) {
+	for _, m := range migrations {
+		if m.Version <= from {
+			continue
+		}
+		var upgrade func(map[string]any) bool
+		switch kind {
+		case "user":
+			upgrade = m.user
+		case "ticket":
+			upgrade = m.ticket
+		case "location":
+			upgrade = m.location
+		}
+		if upgrade != nil && upgrade(record) {
+			changed[m.Version]++
+		}
+	}
+}
+
+// decodeRaw decodes JSON keeping numbers exact, so records survive being
+// decoded into maps and encoded again.
+func decodeRaw(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func stringField(record map[string]any, key string) string {
+	s, _ := record[key].(string)
+	return s
+}
+
+func upgradeTicketStatus(ticket map[string]any) bool {
+	if stringField(ticket, "status") != "" {
+		return false
+	}
+	if ticket["cancelled_at"] != nil {
+		ticket["status"] = models.TicketCancelled
+	} else {
+		ticket["status"] = models.TicketActive
+	}
+	return true
+}
+
+func upgradeTicketDate(ticket map[string]any) bool {
+	if stringField(ticket, "date") != "" {
+		return false
+	}
+	created, err := time.Parse(time.RFC3339Nano, stringField(ticket, "created_at"))
+	if err != nil {
+		return false
+	}
+	ticket["date"] = created.In(time.Local).Format("2006-01-02")
+	return true
+}
+
+func upgradeUserRole(user map[string]any) bool {
+	if strings.TrimSpace(stringField(user, "role")) != "" {
+		return false
+	}
+	user["role"] = models.RoleUser
+	return true
+}
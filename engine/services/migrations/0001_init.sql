@@ -0,0 +1,57 @@
+CREATE TABLE users (
+	id         TEXT PRIMARY KEY,
+	nik        TEXT NOT NULL,
+	nama       TEXT NOT NULL,
+	whatsapp   TEXT NOT NULL,
+	email      TEXT NOT NULL,
+	password   TEXT NOT NULL,
+	role       TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL,
+	CONSTRAINT users_nik_key UNIQUE (nik),
+	CONSTRAINT users_email_key UNIQUE (email),
+	CONSTRAINT users_whatsapp_key UNIQUE (whatsapp)
+);
+
+CREATE TABLE locations (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	quota      BIGINT NOT NULL,
+	region     TEXT NOT NULL DEFAULT '',
+	enabled    BOOLEAN NOT NULL,
+	slots      JSONB NOT NULL DEFAULT '[]',
+	gate_open  TEXT NOT NULL DEFAULT '',
+	gate_close TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- Tickets keep the location name they were issued with, and war tickets
+-- use a location ID that is not in the catalog, so there is no foreign
+-- key to locations.
+CREATE TABLE tickets (
+	id            TEXT PRIMARY KEY,
+	user_id       TEXT NOT NULL REFERENCES users (id),
+	location_id   TEXT NOT NULL,
+	location_name TEXT NOT NULL,
+	ticket_number TEXT NOT NULL,
+	code          TEXT NOT NULL,
+	time_slot     TEXT NOT NULL DEFAULT '',
+	date          TEXT NOT NULL,
+	status        TEXT NOT NULL DEFAULT '',
+	created_at    TIMESTAMPTZ NOT NULL,
+	cancelled_at  TIMESTAMPTZ,
+	cancelled_by  TEXT NOT NULL DEFAULT '',
+	redeemed_at   TIMESTAMPTZ,
+	redeemed_by   TEXT NOT NULL DEFAULT '',
+	no_show_at    TIMESTAMPTZ,
+	no_show_by    TEXT NOT NULL DEFAULT '',
+	expired_at    TIMESTAMPTZ
+);
+
+CREATE INDEX tickets_user_id_idx ON tickets (user_id);
+CREATE INDEX tickets_location_date_idx ON tickets (location_id, date);
+
+CREATE TABLE sequences (
+	key   TEXT PRIMARY KEY,
+	value BIGINT NOT NULL
+);
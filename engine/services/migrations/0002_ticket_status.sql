@@ -0,0 +1,3 @@
+UPDATE tickets
+SET status = CASE WHEN cancelled_at IS NOT NULL THEN 'cancelled' ELSE 'active' END
+WHERE status = '';
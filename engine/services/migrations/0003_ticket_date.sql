@@ -0,0 +1,3 @@
+UPDATE tickets
+SET date = to_char(created_at, 'YYYY-MM-DD')
+WHERE date = '';
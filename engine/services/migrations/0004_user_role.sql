@@ -0,0 +1,3 @@
+UPDATE users
+SET role = 'user'
+WHERE btrim(role) = '';
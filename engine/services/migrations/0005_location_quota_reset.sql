@@ -0,0 +1 @@
+ALTER TABLE locations ADD COLUMN quota_reset_at TIMESTAMPTZ;
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN location_id TEXT NOT NULL DEFAULT '';
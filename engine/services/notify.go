@@ -0,0 +1,75 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	NotifyWaitlistOffer   = "waitlist_offer"
+	NotifyWaitlistIssued  = "waitlist_issued"
+	NotifyWaitlistExpired = "waitlist_offer_expired"
+)
+
+// Notification is a message for one user, e.g. a waitlist offer.
+type Notification struct {
+	Kind    string    `json:"kind"`
+	UserID  string    `json:"user_id"`
+	Message string    `json:"message"`
+	Data    any       `json:"data,omitempty"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+// Notifier delivers notifications to users. Delivery is best effort;
+// callers log failures and carry on.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// NewNotifier returns a webhook notifier when NOTIFY_WEBHOOK_URL is set
+// (a bot or messaging gateway can consume the JSON posts), otherwise one
+// that only logs.
+func NewNotifier() Notifier {
+	if url := strings.TrimSpace(os.Getenv("NOTIFY_WEBHOOK_URL")); url != "" {
+		return &WebhookNotifier{
+			URL:    url,
+			Client: &http.Client{Timeout: 5 * time.Second},
+		}
+	}
+	return LogNotifier{}
+}
+
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(n Notification) error {
+	log.Printf("notify %s user=%s: %s", n.Kind, n.UserID, n.Message)
+	return nil
+}
+
+// WebhookNotifier posts each notification as JSON to URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w *WebhookNotifier) Notify(n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	resp, err := w.Client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notify webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrQueueTokenInvalid = errors.New("queue token invalid")
+	ErrQueueNotAdmitted  = errors.New("queue position not admitted yet")
+	ErrQueueTokenUsed    = errors.New("queue token already used")
+)
+
+// QueueService is the FIFO waiting room in front of the war endpoint.
+// Every arrival draws a sequence number; a ticker moves the admission
+// cursor forward by a fixed number of positions per second, and only
+// positions behind the cursor may proceed to the quota decrement.
+// Redis holds the sequence and cursor so all engine replicas share one
+// queue; without Redis the queue is local to this process.
+type QueueService struct {
+	signer   tokenSigner
+	redis    *RedisService
+	gate     *GateService
+	rate     int64
+	tokenTTL time.Duration
+	stop     chan struct{}
+
+	// Fallback state when Redis is unavailable
+	mu       sync.Mutex
+	seq      int64
+	admitted int64
+	byUser   map[string]int64
+	used     map[int64]bool
+}
+
+type QueueTicket struct {
+	Token     string `json:"token"`
+	Number    int64  `json:"number"`
+	Position  int64  `json:"position"`
+	Admitted  bool   `json:"admitted"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// Returns the caller's existing number if they are already queued so
+// re-joining cannot be used to skip ahead.
+var joinQueueScript = redis.NewScript(`
+local existing = redis.call('GET', KEYS[2])
+if existing then
+	return tonumber(existing)
+end
+local seq = redis.call('INCR', KEYS[1])
+redis.call('SET', KEYS[2], seq, 'EX', ARGV[1])
+return seq
+`)
+
+// Advances the cursor by ARGV[1] but never past the last issued number,
+// so an idle queue does not bank admissions for the next spike. The
+// per-second lock key makes sure only one replica advances per tick.
+// Returns the new cursor, or -1 when it did not move.
+var advanceQueueScript = redis.NewScript(`
+if not redis.call('SET', KEYS[3], 1, 'NX', 'EX', 2) then
+	return -1
+end
+local seq = tonumber(redis.call('GET', KEYS[1]) or '0')
+local admitted = tonumber(redis.call('GET', KEYS[2]) or '0')
+local nextAdmitted = math.min(admitted + tonumber(ARGV[1]), seq)
+if nextAdmitted <= admitted then
+	return -1
+end
+redis.call('SET', KEYS[2], nextAdmitted)
+return nextAdmitted
+`)
+
+const (
+	queueSeqKey      = "queue:seq"
+	queueAdmittedKey = "queue:admitted"
+)
+
+func NewQueueService(redis *RedisService, gate *GateService) *QueueService {
+	secret := readSecret("QUEUE_SECRET")
+
+	rate := int64(50)
+	if raw := strings.TrimSpace(os.Getenv("QUEUE_ADMIT_PER_SECOND")); raw != "" {
+		if parsed, err := strconv.ParseInt(raw, 10, 64); err == nil && parsed > 0 {
+			rate = parsed
+		}
+	}
+
+	return &QueueService{
+		signer:   newTokenSigner(secret),
+		redis:    redis,
+		gate:     gate,
+		rate:     rate,
+		tokenTTL: readSeconds("QUEUE_TOKEN_TTL_SECONDS", 1800),
+		byUser:   make(map[string]int64),
+		used:     make(map[int64]bool),
+	}
+}
+
+// Start runs the admission ticker until Stop is called.
+func (q *QueueService) Start() {
+	q.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-q.stop:
+				return
+			case now := <-ticker.C:
+				if err := q.advance(now); err != nil {
+					log.Printf("queue advance failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (q *QueueService) Stop() {
+	if q.stop != nil {
+		close(q.stop)
+	}
+}
+
+func (q *QueueService) advance(now time.Time) error {
+	// Nobody is admitted while the war gate is shut, so the queue keeps
+	// its order until opening instead of piling up at the gate.
+	if _, err := q.gate.Check(WarQuotaID, now); err != nil {
+		return nil
+	}
+
+	admitted := int64(-1)
+	if q.redis.IsConnected() {
+		tickKey := "queue:tick:" + strconv.FormatInt(now.Unix(), 10)
+		val, err := advanceQueueScript.Run(ctx, q.redis.Client, []string{queueSeqKey, queueAdmittedKey, tickKey}, q.rate).Int64()
+		if err != nil {
+			return err
+		}
+		admitted = val
+	} else {
+		q.mu.Lock()
+		if next := min(q.admitted+q.rate, q.seq); next > q.admitted {
+			q.admitted = next
+			admitted = next
+		}
+		q.mu.Unlock()
+	}
+
+	if admitted >= 0 {
+		q.redis.Events.Publish(EventQueue, QueueEvent{Admitted: admitted})
+	}
+	return nil
+}
+
+// Join puts the user in the queue, or returns their current place if
+// they are already waiting.
+func (q *QueueService) Join(userID string) (QueueTicket, error) {
+	var number int64
+	if q.redis.IsConnected() {
+		n, err := joinQueueScript.Run(ctx, q.redis.Client, []string{queueSeqKey, queueUserKey(userID)},
+			int64(q.tokenTTL.Seconds())).Int64()
+		if err != nil {
+			return QueueTicket{}, err
+		}
+		number = n
+	} else {
+		q.mu.Lock()
+		if n, exists := q.byUser[userID]; exists && !q.used[n] {
+			number = n
+		} else {
+			q.seq++
+			number = q.seq
+			q.byUser[userID] = number
+		}
+		q.mu.Unlock()
+	}
+
+	exp := time.Now().Add(q.tokenTTL).Unix()
+	token := q.signer.sign(exp, "queue", strconv.FormatInt(number, 10)+","+userID)
+	return q.ticket(token, number, exp)
+}
+
+// Status reports the current place of a queue token owned by userID.
+func (q *QueueService) Status(token, userID string) (QueueTicket, error) {
+	number, exp, err := q.parse(token, userID)
+	if err != nil {
+		return QueueTicket{}, err
+	}
+	return q.ticket(token, number, exp)
+}
+
+// Consume spends an admitted queue token. Each token lets its owner
+// through exactly once.
+func (q *QueueService) Consume(token, userID string) error {
+	number, _, err := q.parse(token, userID)
+	if err != nil {
+		return err
+	}
+	admitted, err := q.admittedUpTo()
+	if err != nil {
+		return err
+	}
+	if number > admitted {
+		return ErrQueueNotAdmitted
+	}
+
+	if q.redis.IsConnected() {
+		usedKey := "queue:used:" + strconv.FormatInt(number, 10)
+		ok, err := q.redis.Client.SetNX(ctx, usedKey, 1, q.tokenTTL).Result()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrQueueTokenUsed
+		}
+		q.redis.Client.Del(ctx, queueUserKey(userID))
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.used[number] {
+		return ErrQueueTokenUsed
+	}
+	q.used[number] = true
+	delete(q.byUser, userID)
+	return nil
+}
+
+// Number returns the queue number behind a valid token without checking
+// its owner, for read-only uses such as the live event stream.
+func (q *QueueService) Number(token string) (int64, error) {
+	number, _, _, err := q.parseToken(token)
+	return number, err
+}
+
+// Position reports how many places are left before number is admitted.
+func (q *QueueService) Position(number int64) (QueueTicket, error) {
+	return q.ticket("", number, 0)
+}
+
+func (q *QueueService) parse(token, userID string) (int64, int64, error) {
+	number, owner, exp, err := q.parseToken(token)
+	if err != nil || owner != userID {
+		return 0, 0, ErrQueueTokenInvalid
+	}
+	return number, exp, nil
+}
+
+func (q *QueueService) parseToken(token string) (int64, string, int64, error) {
+	exp, kind, data, err := q.signer.parse(token)
+	if err != nil || kind != "queue" || time.Now().Unix() > exp {
+		return 0, "", 0, ErrQueueTokenInvalid
+	}
+	rawNumber, owner, ok := strings.Cut(data, ",")
+	if !ok {
+		return 0, "", 0, ErrQueueTokenInvalid
+	}
+	number, err := strconv.ParseInt(rawNumber, 10, 64)
+	if err != nil {
+		return 0, "", 0, ErrQueueTokenInvalid
+	}
+	return number, owner, exp, nil
+}
+
+func (q *QueueService) ticket(token string, number, exp int64) (QueueTicket, error) {
+	admitted, err := q.admittedUpTo()
+	if err != nil {
+		return QueueTicket{}, err
+	}
+	return QueueTicket{
+		Token:     token,
+		Number:    number,
+		Position:  max(number-admitted, 0),
+		Admitted:  number <= admitted,
+		ExpiresAt: exp,
+	}, nil
+}
+
+func (q *QueueService) admittedUpTo() (int64, error) {
+	if q.redis.IsConnected() {
+		val, err := q.redis.Client.Get(ctx, queueAdmittedKey).Int64()
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return val, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.admitted, nil
+}
+
+func queueUserKey(userID string) string {
+	return "queue:user:" + userID
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+	"war-ticket-engine/models"
+)
+
+// Reconciler repairs drift between issued tickets and the quota
+// counters. Each pass it
+//   - marks tickets whose time slot has passed as expired;
+//   - settles reservations older than RESERVATION_GRACE_SECONDS (or that
+//     long past their expiry): committed when their ticket exists, rolled
+//     back otherwise (the process died between taking the seat and
+//     storing the ticket);
+//   - compares the counter of every configured slot, today and on each
+//     later date with tickets or reservations (cancelled ones included),
+//     and the war counter, with capacity minus issued tickets minus open
+//     reservations;
+//   - does the same for every location counter, counting the tickets and
+//     reservations made since the location's last quota reset.
+//
+// A counter is only corrected when the same difference is seen on two
+// passes in a row, so a booking completing during the count is not
+// mistaken for drift.
+type Reconciler struct {
+	redis    *RedisService
+	store    Store
+	writer   *TicketWriter
+	interval time.Duration
+	grace    time.Duration
+	stop     chan struct{}
+
+	mu      sync.Mutex
+	suspect map[string]int64
+}
+
+type slotCounter struct {
+	locationID string
+	date       string
+	slot       models.TimeSlot
+}
+
+func NewReconciler(redis *RedisService, store Store, writer *TicketWriter) *Reconciler {
+	return &Reconciler{
+		redis:    redis,
+		store:    store,
+		writer:   writer,
+		interval: readSeconds("RECONCILE_INTERVAL_SECONDS", 60),
+		grace:    readSeconds("RESERVATION_GRACE_SECONDS", 120),
+		suspect:  make(map[string]int64),
+	}
+}
+
+// Start runs a pass and seeds the holding counters immediately, then
+// runs a pass every interval until Stop.
+func (r *Reconciler) Start() {
+	// In-memory counters start from full capacity on every boot, so they
+	// are corrected at once; shared Redis counters may be in use by other
+	// replicas and go through the usual two-pass check.
+	if err := r.Reconcile(time.Now(), !r.redis.IsConnected()); err != nil {
+		log.Printf("reconcile failed: %v", err)
+	}
+	if err := r.seedHoldings(time.Now()); err != nil {
+		log.Printf("seeding holdings failed: %v", err)
+	}
+
+	r.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case now := <-ticker.C:
+				if err := r.Reconcile(now, false); err != nil {
+					log.Printf("reconcile failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (r *Reconciler) Stop() {
+	if r.stop != nil {
+		close(r.stop)
+	}
+}
+
+// Reconcile runs one pass. With immediate set, counter drift is
+// corrected without waiting for a second pass to confirm it.
+func (r *Reconciler) Reconcile(now time.Time, immediate bool) error {
+	if expired, err := ExpireTickets(r.store, now); err != nil {
+		return err
+	} else if expired > 0 {
+		log.Printf("reconcile: %d tickets expired", expired)
+	}
+
+	issued, err := r.issuedTickets()
+	if err != nil {
+		return err
+	}
+
+	open, err := r.settleReservations(now, issued)
+	if err != nil {
+		return err
+	}
+
+	today := now.Format("2006-01-02")
+	locations := make(map[string]models.Location)
+	for _, location := range r.store.ListLocations() {
+		locations[location.ID] = location
+	}
+	used := make(map[string]int64)
+	locationUsed := make(map[string]int64)
+	// Dates to check per location. A date stays in even when all its
+	// tickets were cancelled, so a counter that leaked is still repaired.
+	dates := make(map[string]map[string]struct{})
+	for id := range locations {
+		dates[id] = map[string]struct{}{today: {}}
+	}
+	warUsed := int64(0)
+	count := func(locationID, date, start string, created time.Time, holds bool) {
+		if locationID == WarQuotaID {
+			if holds {
+				warUsed++
+			}
+			return
+		}
+		location, exists := locations[locationID]
+		if !exists {
+			return
+		}
+		if date >= today {
+			dates[locationID][date] = struct{}{}
+		}
+		if !holds {
+			return
+		}
+		if location.QuotaResetAt == nil || !created.Before(*location.QuotaResetAt) {
+			locationUsed[locationID]++
+		}
+		used[slotQuotaKey(locationID, date, start)]++
+	}
+	for _, ticket := range issued {
+		// Redeemed tickets used their seat; only cancelled ones gave it back.
+		count(ticket.LocationID, ticket.Date, ticket.TimeSlot, ticket.CreatedAt, ticket.Status != models.TicketCancelled)
+	}
+	for _, reservation := range open {
+		count(reservation.LocationID, reservation.Date, reservation.Slot.Start, reservation.CreatedAt, true)
+	}
+
+	var slots []slotCounter
+	for id, location := range locations {
+		for date := range dates[id] {
+			for _, slot := range location.Slots {
+				slots = append(slots, slotCounter{locationID: id, date: date, slot: slot})
+			}
+		}
+	}
+	for _, target := range slots {
+		key := slotQuotaKey(target.locationID, target.date, target.slot.Start)
+		expected := max(target.slot.Capacity-used[key], 0)
+		actual, err := r.redis.GetSlotQuota(target.locationID, target.date, target.slot)
+		if err != nil {
+			return err
+		}
+		if r.drifted(key, actual, expected, immediate) {
+			log.Printf("reconcile: slot %s %s %s remaining %d, expected %d", target.locationID, target.date, target.slot.Start, actual, expected)
+			if err := r.redis.SetSlotQuota(target.locationID, target.date, target.slot, expected); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, location := range locations {
+		expected := max(location.Quota-locationUsed[location.ID], 0)
+		actual, err := r.redis.GetLocationQuota(location.ID)
+		if err != nil {
+			return err
+		}
+		if r.drifted(locationQuotaKey(location.ID), actual, expected, immediate || actual < 0) {
+			log.Printf("reconcile: location %s remaining %d, expected %d", location.ID, actual, expected)
+			if err := r.redis.ResetLocationQuota(location.ID, expected); err != nil {
+				return err
+			}
+		}
+	}
+
+	expected := max(WarQuota-warUsed, 0)
+	actual, err := r.redis.GetQuota()
+	if err != nil {
+		return err
+	}
+	// A negative war counter is always wrong, no need to confirm it.
+	if r.drifted(warQuotaKey, actual, expected, immediate || actual < 0) {
+		log.Printf("reconcile: war quota remaining %d, expected %d", actual, expected)
+		if err := r.redis.SetQuota(expected); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedHoldings rebuilds the per-NIK holding counters from the issued
+// tickets and the open reservations.
+func (r *Reconciler) seedHoldings(now time.Time) error {
+	issued, err := r.issuedTickets()
+	if err != nil {
+		return err
+	}
+	reservations, err := r.redis.ListReservations()
+	if err != nil {
+		return err
+	}
+	tickets := make([]models.Ticket, 0, len(issued))
+	for _, ticket := range issued {
+		tickets = append(tickets, ticket)
+	}
+	open := reservations[:0]
+	for _, reservation := range reservations {
+		if _, stored := issued[reservation.TicketID]; !stored {
+			open = append(open, reservation)
+		}
+	}
+	return r.redis.SeedHoldings(r.store, tickets, open, now)
+}
+
+// issuedTickets returns stored tickets plus those still in the write
+// queue, keyed by ticket ID.
+func (r *Reconciler) issuedTickets() (map[string]models.Ticket, error) {
+	issued := make(map[string]models.Ticket)
+	for _, ticket := range r.store.ListTickets() {
+		issued[ticket.ID] = ticket
+	}
+	pending, err := r.writer.PendingTickets()
+	if err != nil {
+		return nil, err
+	}
+	for _, ticket := range pending {
+		issued[ticket.ID] = ticket
+	}
+	return issued, nil
+}
+
+// settleReservations commits or rolls back reservations past the grace
+// period and returns the ones still open.
+func (r *Reconciler) settleReservations(now time.Time, issued map[string]models.Ticket) ([]Reservation, error) {
+	reservations, err := r.redis.ListReservations()
+	if err != nil {
+		return nil, err
+	}
+
+	open := reservations[:0]
+	for _, reservation := range reservations {
+		if _, stored := issued[reservation.TicketID]; stored {
+			// Counted as issued already; only the ledger entry is left.
+			if _, err := r.redis.CommitReservation(reservation); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		deadline := reservation.CreatedAt
+		if !reservation.ExpiresAt.IsZero() {
+			deadline = reservation.ExpiresAt
+		}
+		if now.Sub(deadline) < r.grace {
+			open = append(open, reservation)
+			continue
+		}
+		log.Printf("reconcile: rolling back abandoned reservation %s (%s %s %s)",
+			reservation.TicketID, reservation.LocationID, reservation.Date, reservation.Slot.Start)
+		if err := r.redis.RollbackReservation(reservation); err != nil {
+			return nil, err
+		}
+	}
+	return open, nil
+}
+
+// drifted reports whether a counter should be corrected: actual differs
+// from expected and either immediate is set or the previous pass saw the
+// same difference.
+func (r *Reconciler) drifted(key string, actual, expected int64, immediate bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if actual == expected {
+		delete(r.suspect, key)
+		return false
+	}
+	diff := actual - expected
+	if previous, seen := r.suspect[key]; immediate || (seen && previous == diff) {
+		delete(r.suspect, key)
+		return true
+	}
+	r.suspect[key] = diff
+	return false
+}
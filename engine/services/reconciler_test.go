@@ -0,0 +1,126 @@
+package services
+
+import (
+	"testing"
+	"time"
+	"war-ticket-engine/models"
+)
+
+func newTestRedis() *RedisService {
+	s := &RedisService{
+		memoryQuota:    WarQuota,
+		locationQuotas: make(map[string]int64),
+		slotQuotas:     make(map[string]int64),
+	}
+	s.Events = newEventBroker(s)
+	return s
+}
+
+func TestReconcileLocationQuotaCountsTicketsSinceReset(t *testing.T) {
+	now := time.Now()
+	resetAt := now.Add(-time.Hour)
+	tomorrow := now.AddDate(0, 0, 1).Format("2006-01-02")
+
+	tests := []struct {
+		name    string
+		resetAt *time.Time
+		want    int64
+	}{
+		{"never reset", nil, 8},
+		{"reset an hour ago", &resetAt, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := newTestJSONStore(t)
+			location := models.Location{
+				ID: "juanda", Name: "Juanda", Quota: 10, Enabled: true,
+				Slots:        []models.TimeSlot{{Start: "09:00", End: "10:00", Capacity: 10}},
+				QuotaResetAt: tt.resetAt,
+			}
+			if _, err := db.AddLocation(location); err != nil {
+				t.Fatalf("AddLocation: %v", err)
+			}
+			tickets := []struct {
+				id      string
+				status  string
+				created time.Time
+			}{
+				{"t1", models.TicketActive, now},
+				{"t2", models.TicketCancelled, now},
+				{"t3", models.TicketRedeemed, now.Add(-2 * time.Hour)},
+			}
+			for _, tk := range tickets {
+				ticket := testTicket(tk.id, "u1")
+				ticket.Date, ticket.TimeSlot, ticket.Status, ticket.CreatedAt = tomorrow, "09:00", tk.status, tk.created
+				if err := db.SaveTicket(ticket); err != nil {
+					t.Fatalf("SaveTicket: %v", err)
+				}
+			}
+
+			redis := newTestRedis()
+			if err := redis.InitLocationQuota("juanda", location.Quota); err != nil {
+				t.Fatalf("InitLocationQuota: %v", err)
+			}
+			reconciler := NewReconciler(redis, db, NewTicketWriter(redis, db))
+			if err := reconciler.Reconcile(now, true); err != nil {
+				t.Fatalf("Reconcile: %v", err)
+			}
+			if got, _ := redis.GetLocationQuota("juanda"); got != tt.want {
+				t.Errorf("location quota = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileRepairsSlotsWithoutTickets(t *testing.T) {
+	now := time.Now()
+	today := now.Format("2006-01-02")
+	tomorrow := now.AddDate(0, 0, 1).Format("2006-01-02")
+
+	tests := []struct {
+		name      string
+		date      string
+		cancelled bool
+	}{
+		{"all tickets cancelled", tomorrow, true},
+		{"leaked today without any ticket", today, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := newTestJSONStore(t)
+			location := models.Location{
+				ID: "juanda", Name: "Juanda", Quota: 10, Enabled: true,
+				Slots: []models.TimeSlot{{Start: "09:00", End: "10:00", Capacity: 4}},
+			}
+			if _, err := db.AddLocation(location); err != nil {
+				t.Fatalf("AddLocation: %v", err)
+			}
+			if tt.cancelled {
+				ticket := testTicket("t1", "u1")
+				ticket.Date, ticket.TimeSlot, ticket.Status = tt.date, "09:00", models.TicketCancelled
+				if err := db.SaveTicket(ticket); err != nil {
+					t.Fatalf("SaveTicket: %v", err)
+				}
+			}
+
+			redis := newTestRedis()
+			if err := redis.InitLocationQuota("juanda", location.Quota); err != nil {
+				t.Fatalf("InitLocationQuota: %v", err)
+			}
+			slot := location.Slots[0]
+			if err := redis.SetSlotQuota("juanda", tt.date, slot, 1); err != nil {
+				t.Fatalf("SetSlotQuota: %v", err)
+			}
+
+			reconciler := NewReconciler(redis, db, NewTicketWriter(redis, db))
+			for pass := range 2 {
+				if err := reconciler.Reconcile(now, false); err != nil {
+					t.Fatalf("Reconcile pass %d: %v", pass+1, err)
+				}
+			}
+			if got, _ := redis.GetSlotQuota("juanda", tt.date, slot); got != slot.Capacity {
+				t.Errorf("slot remaining = %d, want the full capacity %d", got, slot.Capacity)
+			}
+		})
+	}
+}
@@ -11,25 +11,48 @@ import (
 
 type RedisService struct {
 	Client    *redis.Client
+	Events    *EventBroker
 	connected bool
-	// Fallback in-memory counter when Redis is unavailable
-	memoryQuota int64
-	mu          sync.Mutex
+	// Fallback in-memory counters when Redis is unavailable
+	memoryQuota    int64
+	locationQuotas map[string]int64
+	slotQuotas     map[string]int64
+	// Fallback per-NIK holding counters, keyed like the Redis keys;
+	// holdingsPruned is the day passed dates were last dropped
+	holdings       map[string]int64
+	holdingsPruned string
+	// Fallback reservation ledger, keyed by ticket ID
+	reservations map[string]Reservation
+	mu           sync.Mutex
 }
 
 var ctx = context.Background()
 
-func NewRedisService() *RedisService {
-	client := redis.NewClient(&redis.Options{
+// WarQuotaID identifies the global war quota in quota events.
+const WarQuotaID = "war"
+
+// WarQuota is the number of seats in the global war.
+const WarQuota = 5000
+
+const warQuotaKey = "ticket_quota"
+
+func newRedisClient() *redis.Client {
+	return redis.NewClient(&redis.Options{
 		Addr:     "localhost:6379",
 		Password: "", // no password set
 		DB:       0,  // use default DB
 	})
+}
+
+func NewRedisService() *RedisService {
+	client := newRedisClient()
 
 	service := &RedisService{
-		Client:      client,
-		connected:   false,
-		memoryQuota: 5000, // Default quota
+		Client:         client,
+		connected:      false,
+		memoryQuota:    WarQuota,
+		locationQuotas: make(map[string]int64),
+		slotQuotas:     make(map[string]int64),
 	}
 
 	_, err := client.Ping(ctx).Result()
@@ -41,27 +64,80 @@ func NewRedisService() *RedisService {
 		log.Println("✅ Redis connected")
 		service.connected = true
 		// Initialize quota for testing
-		client.SetNX(ctx, "ticket_quota", 5000, 0)
+		client.SetNX(ctx, warQuotaKey, WarQuota, 0)
 	}
 
+	service.Events = newEventBroker(service)
 	return service
 }
 
+// AtomicDecreaseQuota takes one war seat and returns the remaining
+// quota, or -1 when the war is sold out. Like the location counters it
+// never goes below zero, so losers need no compensating INCR.
 func (s *RedisService) AtomicDecreaseQuota() (int64, error) {
+	var newVal int64
 	if s.connected {
-		// Use Redis DECR (atomic)
-		val, err := s.Client.Decr(ctx, "ticket_quota").Result()
-		return val, err
+		val, err := decreaseLocationQuotaScript.Run(ctx, s.Client, []string{warQuotaKey}).Int64()
+		if err != nil {
+			return val, err
+		}
+		newVal = val
+	} else {
+		// Fallback: compare-and-swap on the in-memory counter
+		newVal = -1
+		for {
+			current := atomic.LoadInt64(&s.memoryQuota)
+			if current <= 0 {
+				break
+			}
+			if atomic.CompareAndSwapInt64(&s.memoryQuota, current, current-1) {
+				newVal = current - 1
+				break
+			}
+		}
+	}
+
+	if newVal >= 0 {
+		s.Events.Publish(EventQuota, QuotaEvent{LocationID: WarQuotaID, Remaining: newVal})
+	}
+	return newVal, nil
+}
+
+// IncreaseQuota gives a war seat back, e.g. to roll back a failed
+// booking.
+func (s *RedisService) IncreaseQuota() (int64, error) {
+	var newVal int64
+	if s.connected {
+		val, err := s.Client.Incr(ctx, warQuotaKey).Result()
+		if err != nil {
+			return 0, err
+		}
+		newVal = val
+	} else {
+		newVal = atomic.AddInt64(&s.memoryQuota, 1)
 	}
 
-	// Fallback: use atomic in-memory counter
-	newVal := atomic.AddInt64(&s.memoryQuota, -1)
+	s.Events.Publish(EventQuota, QuotaEvent{LocationID: WarQuotaID, Remaining: max(newVal, 0)})
 	return newVal, nil
 }
 
+// SetQuota overwrites the remaining war quota.
+func (s *RedisService) SetQuota(remaining int64) error {
+	if s.connected {
+		if err := s.Client.Set(ctx, warQuotaKey, remaining, 0).Err(); err != nil {
+			return err
+		}
+	} else {
+		atomic.StoreInt64(&s.memoryQuota, remaining)
+	}
+
+	s.Events.Publish(EventQuota, QuotaEvent{LocationID: WarQuotaID, Remaining: max(remaining, 0)})
+	return nil
+}
+
 func (s *RedisService) GetQuota() (int64, error) {
 	if s.connected {
-		val, err := s.Client.Get(ctx, "ticket_quota").Int64()
+		val, err := s.Client.Get(ctx, warQuotaKey).Int64()
 		if err == redis.Nil {
 			return 0, nil
 		}
@@ -75,3 +151,124 @@ func (s *RedisService) GetQuota() (int64, error) {
 func (s *RedisService) IsConnected() bool {
 	return s.connected
 }
+
+// Per-location quotas live under location_quota:<id> so every engine
+// replica decrements the same counter.
+func locationQuotaKey(locationID string) string {
+	return "location_quota:" + locationID
+}
+
+// The counter is only decremented while positive, so a sold-out
+// location never goes negative and needs no compensating INCR.
+var decreaseLocationQuotaScript = redis.NewScript(`
+local remaining = tonumber(redis.call('GET', KEYS[1]) or '0')
+if remaining <= 0 then
+	return -1
+end
+return redis.call('DECR', KEYS[1])
+`)
+
+// InitLocationQuota seeds a location's quota unless a value already
+// exists, so restarts keep the remaining count. In-memory counters start
+// full on every boot; the reconciler's first pass, which runs before the
+// server accepts requests, subtracts the tickets already issued.
+func (s *RedisService) InitLocationQuota(locationID string, quota int64) error {
+	if s.connected {
+		return s.Client.SetNX(ctx, locationQuotaKey(locationID), quota, 0).Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.locationQuotas[locationID]; !exists {
+		s.locationQuotas[locationID] = quota
+	}
+	return nil
+}
+
+// DecreaseLocationQuota takes one seat and returns the remaining quota,
+// or -1 when the location is sold out.
+func (s *RedisService) DecreaseLocationQuota(locationID string) (int64, error) {
+	var remaining int64
+	if s.connected {
+		val, err := decreaseLocationQuotaScript.Run(ctx, s.Client, []string{locationQuotaKey(locationID)}).Int64()
+		if err != nil {
+			return 0, err
+		}
+		remaining = val
+	} else {
+		s.mu.Lock()
+		if s.locationQuotas[locationID] <= 0 {
+			remaining = -1
+		} else {
+			s.locationQuotas[locationID]--
+			remaining = s.locationQuotas[locationID]
+		}
+		s.mu.Unlock()
+	}
+
+	if remaining >= 0 {
+		s.publishLocationQuota(locationID, remaining)
+	}
+	return remaining, nil
+}
+
+func (s *RedisService) publishLocationQuota(locationID string, remaining int64) {
+	s.Events.Publish(EventQuota, QuotaEvent{LocationID: locationID, Remaining: max(remaining, 0)})
+}
+
+// IncreaseLocationQuota gives a seat back, e.g. to roll back a failed
+// booking.
+func (s *RedisService) IncreaseLocationQuota(locationID string) (int64, error) {
+	return s.AdjustLocationQuota(locationID, 1)
+}
+
+func (s *RedisService) GetLocationQuota(locationID string) (int64, error) {
+	if s.connected {
+		val, err := s.Client.Get(ctx, locationQuotaKey(locationID)).Int64()
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return val, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locationQuotas[locationID], nil
+}
+
+// ResetLocationQuota overwrites the remaining quota of a location.
+func (s *RedisService) ResetLocationQuota(locationID string, quota int64) error {
+	if s.connected {
+		if err := s.Client.Set(ctx, locationQuotaKey(locationID), quota, 0).Err(); err != nil {
+			return err
+		}
+	} else {
+		s.mu.Lock()
+		s.locationQuotas[locationID] = quota
+		s.mu.Unlock()
+	}
+
+	s.publishLocationQuota(locationID, quota)
+	return nil
+}
+
+// AdjustLocationQuota shifts the remaining quota by delta, used when an
+// operator changes a location's capacity after seats were issued.
+func (s *RedisService) AdjustLocationQuota(locationID string, delta int64) (int64, error) {
+	var remaining int64
+	if s.connected {
+		val, err := s.Client.IncrBy(ctx, locationQuotaKey(locationID), delta).Result()
+		if err != nil {
+			return 0, err
+		}
+		remaining = val
+	} else {
+		s.mu.Lock()
+		s.locationQuotas[locationID] += delta
+		remaining = s.locationQuotas[locationID]
+		s.mu.Unlock()
+	}
+
+	s.publishLocationQuota(locationID, remaining)
+	return remaining, nil
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+	"war-ticket-engine/models"
+)
+
+const reservationsKey = "reservations"
+
+// Reservation is a seat taken from the quota counters (plus the NIK's
+// holding) that is not yet backed by a stored ticket. It is recorded in
+// a ledger until it is either committed, once the ticket is durably
+// stored, or rolled back, which gives the seat and the holding back.
+// Commit and rollback both claim the ledger entry first, so only one of
+// them (or the reconciler) ever acts on a reservation.
+type Reservation struct {
+	TicketID     string          `json:"ticket_id"`
+	NIK          string          `json:"nik"`
+	LocationID   string          `json:"location_id"`
+	Date         string          `json:"date"`
+	Slot         models.TimeSlot `json:"slot"`
+	HoldingScope string          `json:"holding_scope"`
+	CreatedAt    time.Time       `json:"created_at"`
+	// ExpiresAt is set for seats held longer than a request, such as a
+	// waitlist offer; the reconciler leaves them alone until then.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// Reserve records a seat that was just taken with DecreaseSlotQuota (or
+// AtomicDecreaseQuota for the war, with an empty Slot). If the ledger
+// cannot be written the seat is given back right away.
+func (s *RedisService) Reserve(r Reservation) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+
+	if s.connected {
+		raw, err := json.Marshal(r)
+		if err == nil {
+			err = s.Client.HSet(ctx, reservationsKey, r.TicketID, raw).Err()
+		}
+		if err != nil {
+			if restoreErr := s.restoreSeat(r); restoreErr != nil {
+				log.Printf("reservation %s restore failed: %v", r.TicketID, restoreErr)
+			}
+			return err
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reservations == nil {
+		s.reservations = make(map[string]Reservation)
+	}
+	s.reservations[r.TicketID] = r
+	return nil
+}
+
+// CommitReservation marks the seat as consumed. It reports false when the
+// reservation was already settled, e.g. rolled back by the reconciler.
+func (s *RedisService) CommitReservation(r Reservation) (bool, error) {
+	return s.claimReservation(r.TicketID)
+}
+
+// RollbackReservation gives the seat and the holding back, unless the
+// reservation was already settled.
+func (s *RedisService) RollbackReservation(r Reservation) error {
+	claimed, err := s.claimReservation(r.TicketID)
+	if err != nil || !claimed {
+		return err
+	}
+	return s.restoreSeat(r)
+}
+
+// ListReservations returns all reservations that are neither committed
+// nor rolled back.
+func (s *RedisService) ListReservations() ([]Reservation, error) {
+	if s.connected {
+		entries, err := s.Client.HGetAll(ctx, reservationsKey).Result()
+		if err != nil {
+			return nil, err
+		}
+		reservations := make([]Reservation, 0, len(entries))
+		for id, raw := range entries {
+			var r Reservation
+			if err := json.Unmarshal([]byte(raw), &r); err != nil {
+				log.Printf("skipping unreadable reservation %s: %v", id, err)
+				continue
+			}
+			reservations = append(reservations, r)
+		}
+		return reservations, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reservations := make([]Reservation, 0, len(s.reservations))
+	for _, r := range s.reservations {
+		reservations = append(reservations, r)
+	}
+	return reservations, nil
+}
+
+func (s *RedisService) claimReservation(ticketID string) (bool, error) {
+	if s.connected {
+		n, err := s.Client.HDel(ctx, reservationsKey, ticketID).Result()
+		return n > 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.reservations[ticketID]; !exists {
+		return false, nil
+	}
+	delete(s.reservations, ticketID)
+	return true, nil
+}
+
+func (s *RedisService) restoreSeat(r Reservation) error {
+	var err error
+	if r.LocationID == WarQuotaID {
+		_, err = s.IncreaseQuota()
+	} else {
+		err = s.IncreaseSlotQuota(r.LocationID, r.Date, r.Slot)
+	}
+	if err != nil || r.HoldingScope == "" {
+		return err
+	}
+
+	day, parseErr := time.Parse("2006-01-02", r.Date)
+	if parseErr != nil {
+		return parseErr
+	}
+	return s.ReleaseHolding(r.NIK, r.HoldingScope, day)
+}
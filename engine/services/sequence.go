@@ -0,0 +1,56 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Sequence counters outlive their date by the same margin as the slot
+// counters; the persisted high-water mark covers anything later.
+const ticketSequenceTTL = slotQuotaTTL
+
+func ticketSequenceKey(locationID, date string) string {
+	return "ticket_seq:" + locationID + ":" + date
+}
+
+// Starts a lost or expired counter from the persisted high-water mark
+// (ARGV[1]) before incrementing, so numbers are never handed out twice.
+var nextTicketSequenceScript = redis.NewScript(`
+redis.call('SET', KEYS[1], ARGV[1], 'NX')
+local n = redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return n
+`)
+
+// nextTicketSequence allocates the next ticket number for a location
+// and date (YYYY-MM-DD), starting at 1. With Redis the counter is shared
+// by every replica and its high-water mark is also recorded in the
+// store; without Redis the store counter is used directly.
+func nextTicketSequence(redis *RedisService, store Store, locationID, date string) (int64, error) {
+	key := ticketSequenceKey(locationID, date)
+	if !redis.IsConnected() {
+		return store.NextSequence(key)
+	}
+
+	n, err := nextTicketSequenceScript.Run(ctx, redis.Client, []string{key}, store.Sequence(key), int64(ticketSequenceTTL.Seconds())).Int64()
+	if err != nil {
+		return 0, err
+	}
+	// The mark is saved before the number is used, so a Redis restart
+	// cannot hand out a number a stored ticket already has.
+	if err := store.RaiseSequence(key, n); err != nil {
+		return 0, fmt.Errorf("ticket sequence %s high-water mark not saved: %w", key, err)
+	}
+	return n, nil
+}
+
+// sequenceDate formats a YYYY-MM-DD date the way ticket numbers show it.
+func sequenceDate(date string) string {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return day.Format("060102")
+}
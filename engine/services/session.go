@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSessionInvalid = errors.New("session invalid")
+	ErrSessionExpired = errors.New("session expired")
+	ErrSessionRevoked = errors.New("session revoked")
+)
+
+// SessionService issues signed, expiring access/refresh token pairs.
+// Both tokens of a pair share a session ID; revoking that ID (logout or
+// refresh rotation) invalidates the pair on every engine replica when
+// Redis is connected, or on this process in fallback mode.
+type SessionService struct {
+	signer     tokenSigner
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	redis      *RedisService
+	// Fallback revocation list when Redis is unavailable (session ID -> expiry)
+	revoked map[string]int64
+	mu      sync.Mutex
+}
+
+type Session struct {
+	UserID    string
+	SessionID string
+	ExpiresAt int64
+}
+
+type SessionTokens struct {
+	TokenType        string `json:"token_type"`
+	AccessToken      string `json:"access_token"`
+	ExpiresAt        int64  `json:"expires_at"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresAt int64  `json:"refresh_expires_at"`
+}
+
+func NewSessionService(redis *RedisService) *SessionService {
+	secret := readSecret("SESSION_SECRET")
+
+	return &SessionService{
+		signer:     newTokenSigner(secret),
+		accessTTL:  readSeconds("SESSION_TTL_SECONDS", 900),
+		refreshTTL: readSeconds("SESSION_REFRESH_TTL_SECONDS", 7*24*3600),
+		redis:      redis,
+		revoked:    make(map[string]int64),
+	}
+}
+
+func readSeconds(key string, fallback int64) time.Duration {
+	seconds := fallback
+	if raw := strings.TrimSpace(os.Getenv(key)); raw != "" {
+		if parsed, err := strconv.ParseInt(raw, 10, 64); err == nil && parsed > 0 {
+			seconds = parsed
+		}
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func (s *SessionService) Issue(userID string) (SessionTokens, error) {
+	sessionID, err := randomHex(16)
+	if err != nil {
+		return SessionTokens{}, err
+	}
+
+	now := time.Now()
+	accessExp := now.Add(s.accessTTL).Unix()
+	refreshExp := now.Add(s.refreshTTL).Unix()
+	data := userID + "," + sessionID
+
+	return SessionTokens{
+		TokenType:        "Bearer",
+		AccessToken:      s.signer.sign(accessExp, "access", data),
+		ExpiresAt:        accessExp,
+		RefreshToken:     s.signer.sign(refreshExp, "refresh", data),
+		RefreshExpiresAt: refreshExp,
+	}, nil
+}
+
+// Validate resolves an access token to its session.
+func (s *SessionService) Validate(token string) (Session, error) {
+	return s.resolve(token, "access")
+}
+
+// Refresh exchanges a refresh token for a new token pair. The old
+// session is revoked first so a refresh token can only be used once.
+func (s *SessionService) Refresh(refreshToken string) (SessionTokens, error) {
+	session, err := s.resolve(refreshToken, "refresh")
+	if err != nil {
+		return SessionTokens{}, err
+	}
+	if !s.revoke(session.SessionID) {
+		return SessionTokens{}, ErrSessionRevoked
+	}
+	return s.Issue(session.UserID)
+}
+
+// Revoke invalidates the session behind an access or refresh token.
+func (s *SessionService) Revoke(token string) error {
+	_, kind, data, err := s.signer.parse(token)
+	if err != nil || (kind != "access" && kind != "refresh") {
+		return ErrSessionInvalid
+	}
+	_, sessionID, ok := strings.Cut(data, ",")
+	if !ok {
+		return ErrSessionInvalid
+	}
+	s.revoke(sessionID)
+	return nil
+}
+
+func (s *SessionService) resolve(token, kind string) (Session, error) {
+	exp, gotKind, data, err := s.signer.parse(token)
+	if err != nil || gotKind != kind {
+		return Session{}, ErrSessionInvalid
+	}
+	if time.Now().Unix() > exp {
+		return Session{}, ErrSessionExpired
+	}
+	userID, sessionID, ok := strings.Cut(data, ",")
+	if !ok || userID == "" || sessionID == "" {
+		return Session{}, ErrSessionInvalid
+	}
+	if s.isRevoked(sessionID) {
+		return Session{}, ErrSessionRevoked
+	}
+	return Session{UserID: userID, SessionID: sessionID, ExpiresAt: exp}, nil
+}
+
+// revoke marks a session ID as revoked for the lifetime of its refresh
+// token. It reports false when the session had already been revoked.
+func (s *SessionService) revoke(sessionID string) bool {
+	if s.redis != nil && s.redis.IsConnected() {
+		ok, err := s.redis.Client.SetNX(ctx, "session_revoked:"+sessionID, 1, s.refreshTTL).Result()
+		return err == nil && ok
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().Unix()
+	for id, exp := range s.revoked {
+		if exp < now {
+			delete(s.revoked, id)
+		}
+	}
+	if _, exists := s.revoked[sessionID]; exists {
+		return false
+	}
+	s.revoked[sessionID] = time.Now().Add(s.refreshTTL).Unix()
+	return true
+}
+
+func (s *SessionService) isRevoked(sessionID string) bool {
+	if s.redis != nil && s.redis.IsConnected() {
+		n, err := s.redis.Client.Exists(ctx, "session_revoked:"+sessionID).Result()
+		// Fail closed: a Redis error must not resurrect a revoked session
+		return err != nil || n > 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, exists := s.revoked[sessionID]
+	return exists
+}
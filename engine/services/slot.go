@@ -0,0 +1,218 @@
+package services
+
+import (
+	"errors"
+	"time"
+	"war-ticket-engine/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrQuotaExhausted = errors.New("location quota exhausted")
+	ErrSlotFull       = errors.New("time slot full")
+)
+
+// Slot counters are created lazily with the slot's capacity the first
+// time a date is booked and expire once the date is long gone.
+const slotQuotaTTL = 8 * 24 * time.Hour
+
+func slotQuotaKey(locationID, date, slot string) string {
+	return "slot_quota:" + locationID + ":" + date + ":" + slot
+}
+
+// Takes one seat from both the location and the slot, or from neither.
+// Returns {location remaining, slot remaining}, or {-1, x} when the
+// location is sold out and {x, -1} when the slot is full.
+var decreaseSlotQuotaScript = redis.NewScript(`
+redis.call('SET', KEYS[2], ARGV[1], 'NX', 'EX', ARGV[2])
+local loc = tonumber(redis.call('GET', KEYS[1]) or '0')
+local slot = tonumber(redis.call('GET', KEYS[2]))
+if loc <= 0 then
+	return {-1, slot}
+end
+if slot <= 0 then
+	return {loc, -1}
+end
+return {redis.call('DECR', KEYS[1]), redis.call('DECR', KEYS[2])}
+`)
+
+var increaseSlotQuotaScript = redis.NewScript(`
+redis.call('SET', KEYS[2], ARGV[1], 'NX', 'EX', ARGV[2])
+return {redis.call('INCR', KEYS[1]), redis.call('INCR', KEYS[2])}
+`)
+
+// DecreaseSlotQuota atomically takes one seat from a location's quota and
+// from one of its time slots on the given date (YYYY-MM-DD). It returns
+// ErrQuotaExhausted or ErrSlotFull when either counter is empty.
+func (s *RedisService) DecreaseSlotQuota(locationID, date string, slot models.TimeSlot) (int64, int64, error) {
+	var location, remaining int64
+	if s.connected {
+		keys := []string{locationQuotaKey(locationID), slotQuotaKey(locationID, date, slot.Start)}
+		vals, err := decreaseSlotQuotaScript.Run(ctx, s.Client, keys, slot.Capacity, int64(slotQuotaTTL.Seconds())).Int64Slice()
+		if err != nil {
+			return 0, 0, err
+		}
+		location, remaining = vals[0], vals[1]
+	} else {
+		s.mu.Lock()
+		key := s.memorySlotKey(locationID, date, slot)
+		location, remaining = s.takeMemorySeat(locationID, key)
+		s.mu.Unlock()
+	}
+
+	location, remaining, err := slotResult(location, remaining)
+	if err == nil {
+		s.publishSlotQuota(locationID, date, slot.Start, location, remaining)
+	}
+	return location, remaining, err
+}
+
+// IncreaseSlotQuota returns a seat taken by DecreaseSlotQuota to both the
+// location and the slot.
+func (s *RedisService) IncreaseSlotQuota(locationID, date string, slot models.TimeSlot) error {
+	var location, remaining int64
+	if s.connected {
+		keys := []string{locationQuotaKey(locationID), slotQuotaKey(locationID, date, slot.Start)}
+		vals, err := increaseSlotQuotaScript.Run(ctx, s.Client, keys, slot.Capacity, int64(slotQuotaTTL.Seconds())).Int64Slice()
+		if err != nil {
+			return err
+		}
+		location, remaining = vals[0], vals[1]
+	} else {
+		s.mu.Lock()
+		key := s.memorySlotKey(locationID, date, slot)
+		s.locationQuotas[locationID]++
+		s.slotQuotas[key]++
+		location, remaining = s.locationQuotas[locationID], s.slotQuotas[key]
+		s.mu.Unlock()
+	}
+
+	s.publishSlotQuota(locationID, date, slot.Start, location, remaining)
+	return nil
+}
+
+// Shifts a slot counter that exists; a date never booked has no counter
+// and starts from the new capacity anyway.
+var adjustSlotQuotaScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+return redis.call('INCRBY', KEYS[1], ARGV[1])
+`)
+
+// AdjustSlotQuota shifts the seats left in a slot on the given date by
+// delta when the date was already booked, used when an operator changes
+// the slot's capacity after seats were issued.
+func (s *RedisService) AdjustSlotQuota(locationID, date, start string, delta int64) error {
+	key := slotQuotaKey(locationID, date, start)
+	var remaining int64
+	if s.connected {
+		val, err := adjustSlotQuotaScript.Run(ctx, s.Client, []string{key}, delta).Int64()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		remaining = val
+	} else {
+		s.mu.Lock()
+		if _, exists := s.slotQuotas[key]; !exists {
+			s.mu.Unlock()
+			return nil
+		}
+		s.slotQuotas[key] += delta
+		remaining = s.slotQuotas[key]
+		s.mu.Unlock()
+	}
+
+	location, err := s.GetLocationQuota(locationID)
+	if err == nil {
+		s.publishSlotQuota(locationID, date, start, location, remaining)
+	}
+	return nil
+}
+
+func (s *RedisService) publishSlotQuota(locationID, date, slot string, location, remaining int64) {
+	remaining = max(min(remaining, location), 0)
+	s.Events.Publish(EventQuota, QuotaEvent{
+		LocationID:    locationID,
+		Remaining:     max(location, 0),
+		Date:          date,
+		Slot:          slot,
+		SlotRemaining: &remaining,
+	})
+}
+
+// GetSlotQuota returns the seats left in a slot on the given date; a
+// slot that was never booked still has its full capacity.
+func (s *RedisService) GetSlotQuota(locationID, date string, slot models.TimeSlot) (int64, error) {
+	if s.connected {
+		val, err := s.Client.Get(ctx, slotQuotaKey(locationID, date, slot.Start)).Int64()
+		if err == redis.Nil {
+			return slot.Capacity, nil
+		}
+		return val, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if val, exists := s.slotQuotas[slotQuotaKey(locationID, date, slot.Start)]; exists {
+		return val, nil
+	}
+	return slot.Capacity, nil
+}
+
+// SetSlotQuota overwrites the seats left in a slot on the given date.
+func (s *RedisService) SetSlotQuota(locationID, date string, slot models.TimeSlot, remaining int64) error {
+	if s.connected {
+		err := s.Client.Set(ctx, slotQuotaKey(locationID, date, slot.Start), remaining, slotQuotaTTL).Err()
+		if err != nil {
+			return err
+		}
+	} else {
+		s.mu.Lock()
+		s.slotQuotas[slotQuotaKey(locationID, date, slot.Start)] = remaining
+		s.mu.Unlock()
+	}
+
+	location, err := s.GetLocationQuota(locationID)
+	if err == nil {
+		s.publishSlotQuota(locationID, date, slot.Start, location, remaining)
+	}
+	return nil
+}
+
+func slotResult(location, slot int64) (int64, int64, error) {
+	switch {
+	case location < 0:
+		return 0, slot, ErrQuotaExhausted
+	case slot < 0:
+		return location, 0, ErrSlotFull
+	}
+	return location, slot, nil
+}
+
+// memorySlotKey returns the fallback counter key, creating the counter
+// with the slot's capacity if needed. Callers must hold s.mu.
+func (s *RedisService) memorySlotKey(locationID, date string, slot models.TimeSlot) string {
+	key := slotQuotaKey(locationID, date, slot.Start)
+	if _, exists := s.slotQuotas[key]; !exists {
+		s.slotQuotas[key] = slot.Capacity
+	}
+	return key
+}
+
+// takeMemorySeat mirrors decreaseSlotQuotaScript. Callers must hold s.mu.
+func (s *RedisService) takeMemorySeat(locationID, key string) (int64, int64) {
+	if s.locationQuotas[locationID] <= 0 {
+		return -1, s.slotQuotas[key]
+	}
+	if s.slotQuotas[key] <= 0 {
+		return s.locationQuotas[locationID], -1
+	}
+	s.locationQuotas[locationID]--
+	s.slotQuotas[key]--
+	return s.locationQuotas[locationID], s.slotQuotas[key]
+}
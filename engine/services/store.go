@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"war-ticket-engine/models"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+var ErrTicketRedeemed = errors.New("ticket already redeemed")
+
+var ErrStoreClosed = errors.New("store is closed")
+
+// Returned by SetUser when another user already has the same NIK, email
+// or WhatsApp number.
+var (
+	ErrDuplicateNIK      = errors.New("nik already registered")
+	ErrDuplicateEmail    = errors.New("email already registered")
+	ErrDuplicateWhatsapp = errors.New("whatsapp already registered")
+)
+
+// Store persists users, tickets, locations and ticket number sequences.
+// Writes return once the change is durable. Lookups report a missing
+// record (or an empty list) when the backend fails; the failure is
+// logged, and the next write surfaces it as an error.
+type Store interface {
+	GetUser(id string) (models.User, bool)
+	GetUserByEmailOrPhone(identifier string) (models.User, bool)
+	GetUserByNIK(nik string) (models.User, bool)
+	// SetUser creates or replaces a user. NIK, email and WhatsApp must
+	// not belong to another user.
+	SetUser(user models.User) error
+	// UpdateUser applies fn to the stored user and saves the result
+	// unless fn returns an error or the result clashes with another user
+	// as in SetUser.
+	UpdateUser(id string, fn func(*models.User) error) (models.User, error)
+
+	GetTicket(id string) (models.Ticket, bool)
+	ListTickets() []models.Ticket
+	TicketsByUser(userID string) []models.Ticket
+	SaveTicket(ticket models.Ticket) error
+	// UpdateTicket applies fn to the stored ticket and saves the result
+	// unless fn returns an error. Concurrent updates of one ticket are
+	// serialised, so fn always sees the latest version.
+	UpdateTicket(id string, fn func(*models.Ticket) error) (models.Ticket, error)
+
+	GetLocation(id string) (models.Location, bool)
+	// ListLocations returns all locations ordered by ID.
+	ListLocations() []models.Location
+	// AddLocation stores a new location and reports false when the ID is
+	// already taken.
+	AddLocation(location models.Location) (bool, error)
+	UpdateLocation(id string, fn func(*models.Location) error) (models.Location, error)
+
+	// Sequence returns the current value of a counter.
+	Sequence(key string) int64
+	// NextSequence increments a counter and returns the new value.
+	NextSequence(key string) (int64, error)
+	// RaiseSequence moves a counter up to n, never down.
+	RaiseSequence(key string, n int64) error
+
+	// Migrations reports every migration in the registry and whether
+	// the stored data has it.
+	Migrations() ([]MigrationStatus, error)
+	// Migrate applies the pending migrations and returns them. With
+	// dryRun nothing is stored; the result shows what would change.
+	Migrate(dryRun bool) ([]MigrationStatus, error)
+
+	// Backup returns a consistent copy of all data.
+	Backup() (Backup, error)
+	// Restore replaces all data with the backup's.
+	Restore(backup Backup) error
+
+	Close() error
+}
+
+// OpenStore opens the configured store and applies any pending
+// migrations.
+func OpenStore() (Store, error) {
+	store, err := OpenStoreUnmigrated()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := store.Migrate(false); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return store, nil
+}
+
+// OpenStoreUnmigrated opens the configured store without migrating it.
+func OpenStoreUnmigrated() (Store, error) {
+	backend, target, err := storeConfig()
+	if err != nil {
+		return nil, err
+	}
+	if backend == "postgres" {
+		return NewPostgresStore(target)
+	}
+	return NewJSONStore(target)
+}
+
+// storeConfig returns the backend selected by STORE_BACKEND and where
+// its data lives: "json" (the default) keeps everything in the file at
+// DATABASE_PATH (default database.json); "postgres" connects to
+// DATABASE_URL.
+func storeConfig() (backend, target string, err error) {
+	backend = strings.ToLower(strings.TrimSpace(os.Getenv("STORE_BACKEND")))
+	switch backend {
+	case "", "json":
+		path := strings.TrimSpace(os.Getenv("DATABASE_PATH"))
+		if path == "" {
+			path = "database.json"
+		}
+		return "json", path, nil
+	case "postgres":
+		url := strings.TrimSpace(os.Getenv("DATABASE_URL"))
+		if url == "" {
+			return "", "", errors.New("DATABASE_URL is required for the postgres store")
+		}
+		return backend, url, nil
+	default:
+		return "", "", fmt.Errorf("unknown STORE_BACKEND %q", backend)
+	}
+}
@@ -0,0 +1,934 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+	"war-ticket-engine/models"
+)
+
+// JSONStore keeps the whole data set in memory. On disk it is a snapshot
+// file plus a write-ahead log next to it (<path>.wal) that holds every
+// change since the snapshot, one JSON record per line. Writes wait until
+// their record is in the log, but they do not write it themselves: a
+// background flusher appends every change made while the previous append
+// was running in one batch with one fsync, so a write costs the same no
+// matter how big the data set is.
+//
+// Load replays the log on top of the snapshot. Once the log holds
+// DATABASE_WAL_COMPACT_RECORDS records (default 10000), every
+// DATABASE_WAL_COMPACT_INTERVAL_SECONDS (default 300) and on Close, the
+// flusher compacts: it replaces the snapshot atomically (temporary file,
+// fsync, rename) and empties the log.
+type JSONStore struct {
+	// SchemaVersion is the schema of the data on disk; see Migrate.
+	SchemaVersion int `json:"schema_version"`
+
+	Users     map[string]models.User     `json:"users"`
+	Tickets   map[string]models.Ticket   `json:"tickets"`
+	Locations map[string]models.Location `json:"locations"`
+	// Sequences holds ticket number counters (see nextTicketSequence).
+	Sequences map[string]int64 `json:"sequences,omitempty"`
+	// Version counts changes. The snapshot records the last one it
+	// includes, so replay skips log records it already covers.
+	Version uint64 `json:"version,omitempty"`
+	mu      sync.RWMutex
+	path    string
+
+	// userTickets indexes ticket IDs by owner. It is derived from
+	// Tickets, rebuilt on Load and kept current by every ticket write.
+	userTickets map[string]map[string]struct{}
+
+	// usersByNIK, usersByEmail and usersByWhatsapp map each value to the
+	// ID of the user holding it. They are derived from Users the same way.
+	usersByNIK      map[string]string
+	usersByEmail    map[string]string
+	usersByWhatsapp map[string]string
+
+	// upgraded counts the records each migration changed while loading
+	// data older than SchemaVersion.
+	upgraded map[int]int
+
+	// readOnly loads leave the files alone; another process owns them.
+	readOnly bool
+
+	// pending holds encoded records not yet in the log; snapshotDue asks
+	// the flusher to compact instead of appending. Both guarded by mu.
+	pending     []pendingRecord
+	snapshotDue bool
+
+	// Log state, used by Load and then only by the flusher.
+	wal             *os.File
+	walSize         int64
+	walRecords      int
+	compactRecords  int
+	compactInterval time.Duration
+
+	// Flush state, guarded by flushMu. durable is the last version on
+	// disk; failed is the version whose flush returned flushErr.
+	flushMu  sync.Mutex
+	flushed  *sync.Cond
+	durable  uint64
+	failed   uint64
+	flushErr error
+	closed   bool
+
+	kick      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewJSONStore(path string) (*JSONStore, error) {
+	db := newJSONStore(path)
+	if err := db.Load(); err != nil {
+		return nil, err
+	}
+	wal, err := os.OpenFile(walPath(path), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := wal.Stat()
+	if err != nil {
+		wal.Close()
+		return nil, err
+	}
+	db.wal, db.walSize = wal, info.Size()
+	go db.run()
+	return db, nil
+}
+
+// newJSONStore returns an empty store for path that has not loaded the
+// file or started the flusher.
+func newJSONStore(path string) *JSONStore {
+	db := &JSONStore{
+		Users:     make(map[string]models.User),
+		Tickets:   make(map[string]models.Ticket),
+		Locations: make(map[string]models.Location),
+		Sequences: make(map[string]int64),
+		path:      path,
+
+		userTickets:     make(map[string]map[string]struct{}),
+		usersByNIK:      make(map[string]string),
+		usersByEmail:    make(map[string]string),
+		usersByWhatsapp: make(map[string]string),
+		upgraded:        make(map[int]int),
+
+		compactRecords:  int(readPositiveInt("DATABASE_WAL_COMPACT_RECORDS", 10000)),
+		compactInterval: readSeconds("DATABASE_WAL_COMPACT_INTERVAL_SECONDS", 300),
+
+		kick: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	db.flushed = sync.NewCond(&db.flushMu)
+	return db
+}
+
+// Load reads the snapshot and replays the log on top of it. A missing
+// file is an empty database; any other read or parse error is returned,
+// so a damaged file is never silently replaced by an empty one.
+func (db *JSONStore) Load() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.readOnly {
+		removeStaleTemps(db.path)
+	}
+	data, err := os.ReadFile(db.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := db.decodeSnapshot(data); err != nil {
+			return err
+		}
+	}
+	records, err := db.replayWAL()
+	if err != nil {
+		return err
+	}
+	db.walRecords = records
+	db.userTickets = make(map[string]map[string]struct{})
+	for _, ticket := range db.Tickets {
+		db.indexTicket(ticket)
+	}
+	db.usersByNIK = make(map[string]string)
+	db.usersByEmail = make(map[string]string)
+	db.usersByWhatsapp = make(map[string]string)
+	for _, user := range db.Users {
+		if err := db.checkUnique(user); err != nil {
+			// Registered before uniqueness was enforced; lookups find
+			// one of them.
+			log.Printf("store: user %s: %v", user.ID, err)
+		}
+		db.indexUser(user)
+	}
+	return nil
+}
+
+// decodeSnapshot decodes the database file, first upgrading its records
+// when it was written by an older schema.
+func (db *JSONStore) decodeSnapshot(data []byte) error {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	if header.SchemaVersion > SchemaVersion {
+		return newerSchemaError(header.SchemaVersion)
+	}
+	if err := json.Unmarshal(data, db); err != nil {
+		return err
+	}
+	if header.SchemaVersion == SchemaVersion {
+		return nil
+	}
+
+	var raw struct {
+		Users     map[string]map[string]any `json:"users"`
+		Tickets   map[string]map[string]any `json:"tickets"`
+		Locations map[string]map[string]any `json:"locations"`
+	}
+	if err := decodeRaw(data, &raw); err != nil {
+		return err
+	}
+	for _, user := range raw.Users {
+		upgradeRecords("user", user, header.SchemaVersion, db.upgraded)
+	}
+	for _, ticket := range raw.Tickets {
+		upgradeRecords("ticket", ticket, header.SchemaVersion, db.upgraded)
+	}
+	for _, location := range raw.Locations {
+		upgradeRecords("location", location, header.SchemaVersion, db.upgraded)
+	}
+	upgraded, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(upgraded, db)
+}
+
+// upgradeWALRecord upgrades the entry in a log record written by the
+// same schema as the snapshot, when that is older than SchemaVersion.
+func (db *JSONStore) upgradeWALRecord(line []byte) ([]byte, error) {
+	var record map[string]any
+	if err := decodeRaw(line, &record); err != nil {
+		return nil, err
+	}
+	for _, kind := range []string{"user", "ticket", "location"} {
+		if entry, ok := record[kind].(map[string]any); ok {
+			upgradeRecords(kind, entry, db.SchemaVersion, db.upgraded)
+		}
+	}
+	return json.Marshal(record)
+}
+
+// Migrations reports the registry against the schema of the file.
+func (db *JSONStore) Migrations() ([]MigrationStatus, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.migrationStatus(false), nil
+}
+
+// Migrate stores the upgraded records with the current schema version.
+// Records are always upgraded in memory while loading, so migrating
+// only writes a fresh snapshot; the log is written in the new schema
+// either way.
+func (db *JSONStore) Migrate(dryRun bool) ([]MigrationStatus, error) {
+	db.mu.Lock()
+	pending := db.migrationStatus(true)
+	if dryRun || len(pending) == 0 {
+		db.mu.Unlock()
+		return pending, nil
+	}
+	db.SchemaVersion = SchemaVersion
+	db.snapshotDue = true
+	db.Version++
+	version := db.Version
+	db.mu.Unlock()
+
+	if err := db.sync(version); err != nil {
+		return nil, err
+	}
+	for i := range pending {
+		pending[i].Applied = true
+	}
+	return pending, nil
+}
+
+// Backup copies all data under the read lock.
+func (db *JSONStore) Backup() (Backup, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	backup := Backup{
+		SchemaVersion: SchemaVersion,
+		CreatedAt:     time.Now(),
+		Backend:       "json",
+		Users:         make([]models.User, 0, len(db.Users)),
+		Tickets:       make([]models.Ticket, 0, len(db.Tickets)),
+		Locations:     make([]models.Location, 0, len(db.Locations)),
+		Sequences:     make(map[string]int64, len(db.Sequences)),
+	}
+	for _, user := range db.Users {
+		backup.Users = append(backup.Users, user)
+	}
+	for _, ticket := range db.Tickets {
+		backup.Tickets = append(backup.Tickets, ticket)
+	}
+	for _, location := range db.Locations {
+		backup.Locations = append(backup.Locations, location)
+	}
+	for key, n := range db.Sequences {
+		backup.Sequences[key] = n
+	}
+	sortBackup(&backup)
+	return backup, nil
+}
+
+// Restore replaces all data with the backup's and writes a snapshot. A
+// backup with clashing users is rejected and the store left unchanged.
+func (db *JSONStore) Restore(backup Backup) error {
+	restored := newJSONStore(db.path)
+	for _, user := range backup.Users {
+		if err := restored.checkUnique(user); err != nil {
+			return fmt.Errorf("user %s: %w", user.ID, err)
+		}
+		restored.putUser(user)
+	}
+	for _, ticket := range backup.Tickets {
+		restored.putTicket(ticket)
+	}
+	for _, location := range backup.Locations {
+		restored.Locations[location.ID] = location
+	}
+	for key, n := range backup.Sequences {
+		restored.Sequences[key] = n
+	}
+
+	db.mu.Lock()
+	db.Users, db.Tickets, db.Locations, db.Sequences = restored.Users, restored.Tickets, restored.Locations, restored.Sequences
+	db.userTickets = restored.userTickets
+	db.usersByNIK, db.usersByEmail, db.usersByWhatsapp = restored.usersByNIK, restored.usersByEmail, restored.usersByWhatsapp
+	db.SchemaVersion = SchemaVersion
+	// Only a snapshot can drop what the log holds.
+	db.snapshotDue = true
+	db.Version++
+	version := db.Version
+	db.mu.Unlock()
+	return db.sync(version)
+}
+
+// migrationStatus lists the registry, or only the migrations newer than
+// the file. Callers must hold the lock.
+func (db *JSONStore) migrationStatus(pendingOnly bool) []MigrationStatus {
+	var statuses []MigrationStatus
+	for _, m := range migrations {
+		applied := m.Version <= db.SchemaVersion
+		if applied && pendingOnly {
+			continue
+		}
+		status := MigrationStatus{Version: m.Version, Name: m.Name, Description: m.Description, Applied: applied}
+		if !applied {
+			status.Changed = db.upgraded[m.Version]
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Save waits until everything changed so far is on disk.
+func (db *JSONStore) Save() error {
+	db.mu.RLock()
+	version := db.Version
+	db.mu.RUnlock()
+	return db.sync(version)
+}
+
+// record queues the log record for a change and returns its version for
+// sync. Callers must hold the write lock.
+func (db *JSONStore) record(rec walRecord) uint64 {
+	db.Version++
+	rec.Version = db.Version
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		// The change cannot be logged; the next snapshot still has it.
+		log.Printf("store: encoding log record failed: %v", err)
+		db.snapshotDue = true
+	} else {
+		db.pending = append(db.pending, pendingRecord{version: db.Version, raw: raw})
+	}
+	return db.Version
+}
+
+// unrecord drops the queued log record of version if the flusher has
+// not taken it yet, for a change undone after a failed sync. A record
+// the flusher did take was lost with the failed flush. Callers must hold
+// the write lock.
+func (db *JSONStore) unrecord(version uint64) {
+	for i, rec := range db.pending {
+		if rec.version == version {
+			db.pending = append(db.pending[:i], db.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// sync asks the flusher to write the file and waits until version is on
+// disk, returning the error of the flush that should have written it.
+func (db *JSONStore) sync(version uint64) error {
+	db.flushMu.Lock()
+	defer db.flushMu.Unlock()
+	for db.durable < version {
+		if db.failed >= version {
+			return db.flushErr
+		}
+		if db.closed {
+			return ErrStoreClosed
+		}
+		select {
+		case db.kick <- struct{}{}:
+		default:
+		}
+		db.flushed.Wait()
+	}
+	return nil
+}
+
+func (db *JSONStore) run() {
+	defer close(db.done)
+	ticker := time.NewTicker(db.compactInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-db.kick:
+			db.flush(false)
+		case <-ticker.C:
+			db.flush(true)
+		case <-db.stop:
+			db.flush(true)
+			return
+		}
+	}
+}
+
+// flush appends the pending records to the log, or writes a snapshot
+// when compact is set, the log is full or an append failed, and wakes
+// the writers waiting for it.
+func (db *JSONStore) flush(compact bool) {
+	db.mu.Lock()
+	version := db.Version
+	db.flushMu.Lock()
+	upToDate := db.durable >= version
+	db.flushMu.Unlock()
+	snapshot := compact || db.snapshotDue || db.walRecords+len(db.pending) >= db.compactRecords
+	if upToDate && (!snapshot || db.walRecords == 0) {
+		db.mu.Unlock()
+		return
+	}
+	batch := make([][]byte, len(db.pending))
+	for i, rec := range db.pending {
+		batch[i] = rec.raw
+	}
+	db.pending = nil
+	var data []byte
+	var err error
+	if snapshot {
+		data, err = json.MarshalIndent(db, "", "  ")
+	}
+	db.mu.Unlock()
+
+	if err == nil {
+		if snapshot {
+			err = db.writeSnapshot(data)
+		} else {
+			err = db.appendWAL(batch)
+		}
+	}
+
+	db.mu.Lock()
+	if err != nil {
+		// Only a snapshot is sure to hold the lost batch.
+		db.snapshotDue = true
+	} else if snapshot {
+		db.snapshotDue = false
+	}
+	db.mu.Unlock()
+
+	db.flushMu.Lock()
+	if err != nil {
+		log.Printf("store: writing %s failed: %v", db.path, err)
+		db.failed, db.flushErr = version, err
+	} else {
+		db.durable = version
+	}
+	db.flushed.Broadcast()
+	db.flushMu.Unlock()
+}
+
+// writeFileAtomic replaces path with data so that readers, and the file
+// left after a crash, see either the old or the new contents.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// Make the rename itself durable.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// removeStaleTemps deletes temporary files left by a flush that crashed
+// before its rename.
+func removeStaleTemps(path string) {
+	matches, _ := filepath.Glob(path + ".tmp-*")
+	for _, match := range matches {
+		os.Remove(match)
+	}
+}
+
+func (db *JSONStore) GetUser(id string) (models.User, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	user, ok := db.Users[id]
+	return user, ok
+}
+
+// SetUser stores the user unless its NIK, email or WhatsApp number
+// belongs to another user. The check and the write happen under one
+// lock, so of two concurrent registrations with the same NIK only one
+// succeeds.
+func (db *JSONStore) SetUser(user models.User) error {
+	db.mu.Lock()
+	if err := db.checkUnique(user); err != nil {
+		db.mu.Unlock()
+		return err
+	}
+	previous, existed := db.Users[user.ID]
+	db.putUser(user)
+	version := db.record(walRecord{User: &user})
+	db.mu.Unlock()
+
+	// Undo the change when it did not reach disk, so the caller's error
+	// holds: the snapshot written after a failed flush must not save it.
+	if err := db.sync(version); err != nil {
+		db.mu.Lock()
+		if current, ok := db.Users[user.ID]; ok && current == user {
+			db.unrecord(version)
+			if existed {
+				db.putUser(previous)
+				db.record(walRecord{User: &previous})
+			} else {
+				db.unindexUser(user)
+				delete(db.Users, user.ID)
+			}
+		}
+		db.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// UpdateUser applies fn to a copy of the user under the write lock and
+// stores the result unless fn returns an error. If the write does not
+// reach disk the change is undone.
+func (db *JSONStore) UpdateUser(id string, fn func(*models.User) error) (models.User, error) {
+	db.mu.Lock()
+	previous, exists := db.Users[id]
+	if !exists {
+		db.mu.Unlock()
+		return models.User{}, ErrNotFound
+	}
+	user := previous
+	if err := fn(&user); err != nil {
+		db.mu.Unlock()
+		return models.User{}, err
+	}
+	if err := db.checkUnique(user); err != nil {
+		db.mu.Unlock()
+		return models.User{}, err
+	}
+	db.putUser(user)
+	version := db.record(walRecord{User: &user})
+	db.mu.Unlock()
+
+	if err := db.sync(version); err != nil {
+		db.mu.Lock()
+		if current, ok := db.Users[id]; ok && current == user {
+			db.unrecord(version)
+			db.putUser(previous)
+			db.record(walRecord{User: &previous})
+		}
+		db.mu.Unlock()
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (db *JSONStore) GetUserByEmailOrPhone(identifier string) (models.User, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	id, ok := db.usersByEmail[identifier]
+	if !ok {
+		id, ok = db.usersByWhatsapp[identifier]
+	}
+	if !ok {
+		return models.User{}, false
+	}
+	return db.Users[id], true
+}
+
+func (db *JSONStore) GetUserByNIK(nik string) (models.User, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	id, ok := db.usersByNIK[nik]
+	if !ok {
+		return models.User{}, false
+	}
+	return db.Users[id], true
+}
+
+// checkUnique reports the first of the user's NIK, email and WhatsApp
+// number that another user already has. Callers must hold the lock.
+func (db *JSONStore) checkUnique(user models.User) error {
+	if id, exists := db.usersByNIK[user.NIK]; exists && id != user.ID {
+		return ErrDuplicateNIK
+	}
+	if id, exists := db.usersByEmail[user.Email]; exists && id != user.ID {
+		return ErrDuplicateEmail
+	}
+	if id, exists := db.usersByWhatsapp[user.Whatsapp]; exists && id != user.ID {
+		return ErrDuplicateWhatsapp
+	}
+	return nil
+}
+
+// putUser stores the user and updates the lookup indexes. Callers must
+// hold the write lock.
+func (db *JSONStore) putUser(user models.User) {
+	if previous, exists := db.Users[user.ID]; exists {
+		db.unindexUser(previous)
+	}
+	db.Users[user.ID] = user
+	db.indexUser(user)
+}
+
+func (db *JSONStore) indexUser(user models.User) {
+	db.usersByNIK[user.NIK] = user.ID
+	db.usersByEmail[user.Email] = user.ID
+	db.usersByWhatsapp[user.Whatsapp] = user.ID
+}
+
+// unindexUser drops the user's index entries, leaving any that point to
+// another user.
+func (db *JSONStore) unindexUser(user models.User) {
+	if db.usersByNIK[user.NIK] == user.ID {
+		delete(db.usersByNIK, user.NIK)
+	}
+	if db.usersByEmail[user.Email] == user.ID {
+		delete(db.usersByEmail, user.Email)
+	}
+	if db.usersByWhatsapp[user.Whatsapp] == user.ID {
+		delete(db.usersByWhatsapp, user.Whatsapp)
+	}
+}
+
+func (db *JSONStore) GetTicket(id string) (models.Ticket, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	ticket, ok := db.Tickets[id]
+	return ticket, ok
+}
+
+// ListTickets returns a copy of all stored tickets.
+func (db *JSONStore) ListTickets() []models.Ticket {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	tickets := make([]models.Ticket, 0, len(db.Tickets))
+	for _, ticket := range db.Tickets {
+		tickets = append(tickets, ticket)
+	}
+	return tickets
+}
+
+// SaveTicket stores the ticket and writes it to disk before returning,
+// for callers that must know the ticket reached disk. If that fails the
+// change is undone, so a booking that reports an error leaves no ticket.
+func (db *JSONStore) SaveTicket(ticket models.Ticket) error {
+	db.mu.Lock()
+	previous, existed := db.Tickets[ticket.ID]
+	db.putTicket(ticket)
+	version := db.record(walRecord{Ticket: &ticket})
+	db.mu.Unlock()
+
+	if err := db.sync(version); err != nil {
+		db.mu.Lock()
+		if current, ok := db.Tickets[ticket.ID]; ok && current == ticket {
+			db.unrecord(version)
+			if existed {
+				db.putTicket(previous)
+				db.record(walRecord{Ticket: &previous})
+			} else {
+				db.removeTicket(ticket)
+			}
+		}
+		db.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// TicketsByUser returns a copy of the tickets owned by userID.
+func (db *JSONStore) TicketsByUser(userID string) []models.Ticket {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	ids := db.userTickets[userID]
+	tickets := make([]models.Ticket, 0, len(ids))
+	for id := range ids {
+		tickets = append(tickets, db.Tickets[id])
+	}
+	return tickets
+}
+
+// UpdateTicket applies fn to a copy of the ticket under the write lock
+// and stores the result unless fn returns an error. The database file is
+// written before returning; if that fails the change is undone.
+func (db *JSONStore) UpdateTicket(id string, fn func(*models.Ticket) error) (models.Ticket, error) {
+	db.mu.Lock()
+	previous, exists := db.Tickets[id]
+	if !exists {
+		db.mu.Unlock()
+		return models.Ticket{}, ErrNotFound
+	}
+	ticket := previous
+	if err := fn(&ticket); err != nil {
+		db.mu.Unlock()
+		return models.Ticket{}, err
+	}
+	db.putTicket(ticket)
+	version := db.record(walRecord{Ticket: &ticket})
+	db.mu.Unlock()
+
+	if err := db.sync(version); err != nil {
+		db.mu.Lock()
+		if current, ok := db.Tickets[id]; ok && current == ticket {
+			db.unrecord(version)
+			db.putTicket(previous)
+			db.record(walRecord{Ticket: &previous})
+		}
+		db.mu.Unlock()
+		return models.Ticket{}, err
+	}
+	return ticket, nil
+}
+
+// putTicket stores the ticket and updates the owner index. Callers must
+// hold the write lock.
+func (db *JSONStore) putTicket(ticket models.Ticket) {
+	if previous, exists := db.Tickets[ticket.ID]; exists && previous.UserID != ticket.UserID {
+		delete(db.userTickets[previous.UserID], ticket.ID)
+	}
+	db.Tickets[ticket.ID] = ticket
+	db.indexTicket(ticket)
+}
+
+// removeTicket deletes the ticket and its owner index entry. Callers
+// must hold the write lock.
+func (db *JSONStore) removeTicket(ticket models.Ticket) {
+	delete(db.Tickets, ticket.ID)
+	delete(db.userTickets[ticket.UserID], ticket.ID)
+}
+
+func (db *JSONStore) indexTicket(ticket models.Ticket) {
+	ids, exists := db.userTickets[ticket.UserID]
+	if !exists {
+		ids = make(map[string]struct{})
+		db.userTickets[ticket.UserID] = ids
+	}
+	ids[ticket.ID] = struct{}{}
+}
+
+// Sequence returns the current value of a counter.
+func (db *JSONStore) Sequence(key string) int64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.Sequences[key]
+}
+
+// NextSequence increments a counter and writes the database file before
+// returning the new value; if that fails the increment is undone.
+func (db *JSONStore) NextSequence(key string) (int64, error) {
+	db.mu.Lock()
+	db.Sequences[key]++
+	n := db.Sequences[key]
+	version := db.record(walRecord{Sequence: &walSequence{Key: key, Value: n}})
+	db.mu.Unlock()
+
+	if err := db.sync(version); err != nil {
+		db.mu.Lock()
+		if db.Sequences[key] == n {
+			db.unrecord(version)
+			db.Sequences[key] = n - 1
+			db.record(walRecord{Sequence: &walSequence{Key: key, Value: n - 1}})
+		}
+		db.mu.Unlock()
+		return 0, err
+	}
+	return n, nil
+}
+
+// RaiseSequence moves a counter up to n, never down, and saves; if that
+// fails the counter is moved back.
+func (db *JSONStore) RaiseSequence(key string, n int64) error {
+	db.mu.Lock()
+	previous := db.Sequences[key]
+	if previous >= n {
+		db.mu.Unlock()
+		return nil
+	}
+	db.Sequences[key] = n
+	version := db.record(walRecord{Sequence: &walSequence{Key: key, Value: n}})
+	db.mu.Unlock()
+
+	if err := db.sync(version); err != nil {
+		db.mu.Lock()
+		if db.Sequences[key] == n {
+			db.unrecord(version)
+			db.Sequences[key] = previous
+			db.record(walRecord{Sequence: &walSequence{Key: key, Value: previous}})
+		}
+		db.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (db *JSONStore) GetLocation(id string) (models.Location, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	location, ok := db.Locations[id]
+	return location, ok
+}
+
+// ListLocations returns all locations ordered by ID.
+func (db *JSONStore) ListLocations() []models.Location {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	locations := make([]models.Location, 0, len(db.Locations))
+	for _, loc := range db.Locations {
+		locations = append(locations, loc)
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].ID < locations[j].ID })
+	return locations
+}
+
+// AddLocation stores a new location and reports false when the ID is
+// already taken. If the write does not reach disk the location is
+// removed again.
+func (db *JSONStore) AddLocation(location models.Location) (bool, error) {
+	db.mu.Lock()
+	if _, exists := db.Locations[location.ID]; exists {
+		db.mu.Unlock()
+		return false, nil
+	}
+	db.Locations[location.ID] = location
+	version := db.record(walRecord{Location: &location})
+	db.mu.Unlock()
+
+	if err := db.sync(version); err != nil {
+		db.mu.Lock()
+		if current, ok := db.Locations[location.ID]; ok && reflect.DeepEqual(current, location) {
+			db.unrecord(version)
+			delete(db.Locations, location.ID)
+		}
+		db.mu.Unlock()
+		return false, err
+	}
+	return true, nil
+}
+
+// UpdateLocation applies fn to a copy of the location under the write
+// lock and stores the result unless fn returns an error. If the write
+// does not reach disk the change is undone.
+func (db *JSONStore) UpdateLocation(id string, fn func(*models.Location) error) (models.Location, error) {
+	db.mu.Lock()
+	previous, exists := db.Locations[id]
+	if !exists {
+		db.mu.Unlock()
+		return models.Location{}, ErrNotFound
+	}
+	location := previous
+	location.Slots = slices.Clone(previous.Slots)
+	if err := fn(&location); err != nil {
+		db.mu.Unlock()
+		return models.Location{}, err
+	}
+	db.Locations[id] = location
+	version := db.record(walRecord{Location: &location})
+	db.mu.Unlock()
+
+	if err := db.sync(version); err != nil {
+		db.mu.Lock()
+		if current, ok := db.Locations[id]; ok && reflect.DeepEqual(current, location) {
+			db.unrecord(version)
+			db.Locations[id] = previous
+			db.record(walRecord{Location: &previous})
+		}
+		db.mu.Unlock()
+		return models.Location{}, err
+	}
+	return location, nil
+}
+
+// Close compacts the log into a final snapshot and stops the flusher.
+// Writes after Close fail with ErrStoreClosed.
+func (db *JSONStore) Close() error {
+	db.closeOnce.Do(func() {
+		close(db.stop)
+		<-db.done
+		db.wal.Close()
+		db.flushMu.Lock()
+		db.closed = true
+		db.flushed.Broadcast()
+		db.flushMu.Unlock()
+	})
+	return db.Save()
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+	"war-ticket-engine/models"
+)
+
+func newTestJSONStore(t *testing.T) (*JSONStore, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := NewJSONStore(path)
+	if err != nil {
+		t.Fatalf("NewJSONStore: %v", err)
+	}
+	return db, path
+}
+
+func testUser(id, nik string) models.User {
+	return models.User{ID: id, NIK: nik, Email: id + "@example.com", Whatsapp: "08" + nik, CreatedAt: time.Now()}
+}
+
+func testTicket(id, userID string) models.Ticket {
+	return models.Ticket{ID: id, UserID: userID, LocationID: "juanda", Date: "2026-01-02", Status: models.TicketActive, CreatedAt: time.Now()}
+}
+
+func TestJSONStoreUndoesWritesThatFailToSync(t *testing.T) {
+	db, _ := newTestJSONStore(t)
+	if err := db.SetUser(testUser("u1", "1")); err != nil {
+		t.Fatalf("SetUser: %v", err)
+	}
+	existing := testTicket("t1", "u1")
+	if err := db.SaveTicket(existing); err != nil {
+		t.Fatalf("SaveTicket: %v", err)
+	}
+
+	// Every flush fails from here on.
+	db.wal.Close()
+
+	if err := db.SaveTicket(testTicket("t2", "u1")); err == nil {
+		t.Fatal("SaveTicket succeeded with a broken log")
+	}
+	if _, ok := db.GetTicket("t2"); ok {
+		t.Error("failed SaveTicket left the new ticket behind")
+	}
+	if got := len(db.TicketsByUser("u1")); got != 1 {
+		t.Errorf("TicketsByUser = %d tickets, want 1", got)
+	}
+
+	changed := existing
+	changed.Status = models.TicketCancelled
+	if err := db.SaveTicket(changed); err == nil {
+		t.Fatal("SaveTicket succeeded with a broken log")
+	}
+	if got, _ := db.GetTicket("t1"); got.Status != models.TicketActive {
+		t.Errorf("failed SaveTicket left status %q, want the previous %q", got.Status, models.TicketActive)
+	}
+
+	if err := db.SetUser(testUser("u2", "2")); err == nil {
+		t.Fatal("SetUser succeeded with a broken log")
+	}
+	if _, ok := db.GetUser("u2"); ok {
+		t.Error("failed SetUser left the new user behind")
+	}
+	if _, ok := db.GetUserByNIK("2"); ok {
+		t.Error("failed SetUser left the NIK indexed")
+	}
+}
+
+func TestJSONStoreUndoesUpdatesThatFailToSync(t *testing.T) {
+	db, _ := newTestJSONStore(t)
+	if err := db.SetUser(testUser("u1", "1")); err != nil {
+		t.Fatalf("SetUser: %v", err)
+	}
+	location := models.Location{
+		ID: "juanda", Name: "Juanda", Quota: 10, Enabled: true,
+		Slots: []models.TimeSlot{{Start: "09:00", End: "10:00", Capacity: 10}},
+	}
+	if _, err := db.AddLocation(location); err != nil {
+		t.Fatalf("AddLocation: %v", err)
+	}
+	if err := db.RaiseSequence("juanda:2026-01-02", 5); err != nil {
+		t.Fatalf("RaiseSequence: %v", err)
+	}
+
+	// Every flush fails from here on.
+	db.wal.Close()
+
+	if _, err := db.UpdateUser("u1", func(u *models.User) error {
+		u.NIK = "9"
+		return nil
+	}); err == nil {
+		t.Fatal("UpdateUser succeeded with a broken log")
+	}
+	if got, _ := db.GetUser("u1"); got.NIK != "1" {
+		t.Errorf("failed UpdateUser left NIK %q, want the previous %q", got.NIK, "1")
+	}
+	if _, ok := db.GetUserByNIK("9"); ok {
+		t.Error("failed UpdateUser left the new NIK indexed")
+	}
+	if _, ok := db.GetUserByNIK("1"); !ok {
+		t.Error("failed UpdateUser dropped the previous NIK from the index")
+	}
+
+	if err := db.RaiseSequence("juanda:2026-01-02", 9); err == nil {
+		t.Fatal("RaiseSequence succeeded with a broken log")
+	}
+	if got := db.Sequence("juanda:2026-01-02"); got != 5 {
+		t.Errorf("failed RaiseSequence left %d, want the previous 5", got)
+	}
+
+	if _, err := db.AddLocation(models.Location{ID: "kualanamu", Name: "Kualanamu"}); err == nil {
+		t.Fatal("AddLocation succeeded with a broken log")
+	}
+	if _, ok := db.GetLocation("kualanamu"); ok {
+		t.Error("failed AddLocation left the new location behind")
+	}
+
+	if _, err := db.UpdateLocation("juanda", func(loc *models.Location) error {
+		loc.Quota = 20
+		loc.Slots[0].Capacity = 20
+		return nil
+	}); err == nil {
+		t.Fatal("UpdateLocation succeeded with a broken log")
+	}
+	if got, _ := db.GetLocation("juanda"); got.Quota != 10 || got.Slots[0].Capacity != 10 {
+		t.Errorf("failed UpdateLocation left quota %d and capacity %d, want 10 and 10", got.Quota, got.Slots[0].Capacity)
+	}
+}
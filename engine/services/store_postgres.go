@@ -0,0 +1,631 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"war-ticket-engine/models"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID serialises migrations between replicas starting at the
+// same time (pg_advisory_lock key).
+const migrationLockID = 7301
+
+// PostgresStore keeps the data in PostgreSQL. NIK, email and WhatsApp
+// uniqueness is enforced by the schema.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore connects to the database. It refuses a database
+// migrated by a newer build but does not migrate; see Migrate.
+func NewPostgresStore(url string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, err
+	}
+	db.SetConnMaxIdleTime(5 * time.Minute)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	store := &PostgresStore{db: db}
+	applied, err := store.appliedMigrations(store.db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	for version := range applied {
+		if version > SchemaVersion {
+			db.Close()
+			return nil, newerSchemaError(version)
+		}
+	}
+	return store, nil
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// appliedMigrations returns when each recorded migration was applied;
+// nothing before the first migration has created the table.
+func (s *PostgresStore) appliedMigrations(q querier) (map[int]time.Time, error) {
+	var exists bool
+	if err := q.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]time.Time)
+	if !exists {
+		return applied, nil
+	}
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+func (s *PostgresStore) Migrations() ([]MigrationStatus, error) {
+	applied, err := s.appliedMigrations(s.db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name, Description: m.Description}
+		if at, ok := applied[m.Version]; ok {
+			status.Applied, status.AppliedAt = true, &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Migrate runs the script of each pending migration in its own
+// transaction and records it in schema_migrations. A dry run executes
+// all of them in one transaction, so later scripts see the effect of
+// earlier ones, and rolls it back.
+func (s *PostgresStore) Migrate(dryRun bool) ([]MigrationStatus, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return nil, err
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	applied, err := s.appliedMigrations(conn)
+	if err != nil {
+		return nil, err
+	}
+	var dryRunTx *sql.Tx
+	if dryRun {
+		if dryRunTx, err = conn.BeginTx(ctx, nil); err != nil {
+			return nil, err
+		}
+		defer dryRunTx.Rollback()
+	}
+
+	var pending []MigrationStatus
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		tx := dryRunTx
+		if !dryRun {
+			if tx, err = conn.BeginTx(ctx, nil); err != nil {
+				return pending, err
+			}
+		}
+		changed, err := runMigration(tx, m)
+		if err == nil && !dryRun {
+			err = tx.Commit()
+		}
+		if err != nil {
+			if !dryRun {
+				tx.Rollback()
+			}
+			return pending, fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		pending = append(pending, MigrationStatus{
+			Version:     m.Version,
+			Name:        m.Name,
+			Description: m.Description,
+			Applied:     !dryRun,
+			Changed:     changed,
+		})
+		if !dryRun {
+			log.Printf("applied migration %d_%s", m.Version, m.Name)
+		}
+	}
+	return pending, nil
+}
+
+// runMigration executes one migration script in tx and records it in
+// schema_migrations. It returns the rows the script's last statement
+// changed.
+func runMigration(tx *sql.Tx, m Migration) (int, error) {
+	script, err := migrationFiles.ReadFile(fmt.Sprintf("migrations/%04d_%s.sql", m.Version, m.Name))
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL
+	)`)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx, string(script))
+	if err != nil {
+		return 0, err
+	}
+	changed, _ := result.RowsAffected()
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, now())`, m.Version)
+	return int(changed), err
+}
+
+// Backup reads all tables in one repeatable-read transaction, so the
+// copy is consistent while the server keeps writing.
+func (s *PostgresStore) Backup() (Backup, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return Backup{}, err
+	}
+	defer tx.Rollback()
+
+	backup := Backup{
+		SchemaVersion: SchemaVersion,
+		CreatedAt:     time.Now(),
+		Backend:       "postgres",
+		Sequences:     make(map[string]int64),
+	}
+	// An unmigrated database is backed up at its own schema version;
+	// restoring the backup upgrades it.
+	applied, err := s.appliedMigrations(tx)
+	if err != nil {
+		return Backup{}, err
+	}
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			backup.SchemaVersion = m.Version - 1
+			break
+		}
+	}
+
+	if err := queryEach(tx, `SELECT `+userColumns+` FROM users`, func(rows *sql.Rows) error {
+		user, err := scanUser(rows)
+		backup.Users = append(backup.Users, user)
+		return err
+	}); err != nil {
+		return Backup{}, err
+	}
+	if err := queryEach(tx, `SELECT `+ticketColumns+` FROM tickets`, func(rows *sql.Rows) error {
+		ticket, err := scanTicket(rows)
+		backup.Tickets = append(backup.Tickets, ticket)
+		return err
+	}); err != nil {
+		return Backup{}, err
+	}
+	if err := queryEach(tx, `SELECT `+locationColumns+` FROM locations`, func(rows *sql.Rows) error {
+		location, err := scanLocation(rows)
+		backup.Locations = append(backup.Locations, location)
+		return err
+	}); err != nil {
+		return Backup{}, err
+	}
+	if err := queryEach(tx, `SELECT key, value FROM sequences`, func(rows *sql.Rows) error {
+		var key string
+		var n int64
+		err := rows.Scan(&key, &n)
+		backup.Sequences[key] = n
+		return err
+	}); err != nil {
+		return Backup{}, err
+	}
+	sortBackup(&backup)
+	return backup, nil
+}
+
+func queryEach(q querier, query string, fn func(rows *sql.Rows) error) error {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Restore empties the tables and loads the backup in one transaction; on
+// any error, clashing users included, nothing changes.
+func (s *PostgresStore) Restore(backup Backup) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `TRUNCATE tickets, users, locations, sequences`); err != nil {
+			return err
+		}
+		for _, user := range backup.Users {
+			_, err := tx.ExecContext(ctx, `INSERT INTO users (`+userColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+				user.ID, user.NIK, user.Nama, user.Whatsapp, user.Email, user.Password, user.Role, user.CreatedAt, user.LocationID)
+			if err != nil {
+				return fmt.Errorf("user %s: %w", user.ID, userConstraintError(err))
+			}
+		}
+		for _, ticket := range backup.Tickets {
+			if _, err := tx.ExecContext(ctx, upsertTicket, ticketArgs(ticket)...); err != nil {
+				return fmt.Errorf("ticket %s: %w", ticket.ID, err)
+			}
+		}
+		for _, location := range backup.Locations {
+			args, err := locationArgs(location)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `INSERT INTO locations (`+locationColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`, args...)
+			if err != nil {
+				return fmt.Errorf("location %s: %w", location.ID, err)
+			}
+		}
+		for key, n := range backup.Sequences {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO sequences (key, value) VALUES ($1, $2)`, key, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// inTx runs fn in a transaction, committing when it returns nil.
+func (s *PostgresStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// found turns the error of a single-row lookup into the bool the Store
+// getters report, logging anything other than a missing row.
+func found(what string, err error) bool {
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("store: %s lookup failed: %v", what, err)
+	}
+	return false
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// Users
+
+const userColumns = `id, nik, nama, whatsapp, email, password, role, created_at, location_id`
+
+func scanUser(row rowScanner) (models.User, error) {
+	var u models.User
+	err := row.Scan(&u.ID, &u.NIK, &u.Nama, &u.Whatsapp, &u.Email, &u.Password, &u.Role, &u.CreatedAt, &u.LocationID)
+	return u, err
+}
+
+func (s *PostgresStore) GetUser(id string) (models.User, bool) {
+	user, err := scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+	return user, found("user", err)
+}
+
+func (s *PostgresStore) GetUserByEmailOrPhone(identifier string) (models.User, bool) {
+	user, err := scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE email = $1 OR whatsapp = $1 LIMIT 1`, identifier))
+	return user, found("user", err)
+}
+
+func (s *PostgresStore) GetUserByNIK(nik string) (models.User, bool) {
+	user, err := scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE nik = $1`, nik))
+	return user, found("user", err)
+}
+
+func (s *PostgresStore) SetUser(user models.User) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO users (`+userColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			nik = EXCLUDED.nik, nama = EXCLUDED.nama, whatsapp = EXCLUDED.whatsapp,
+			email = EXCLUDED.email, password = EXCLUDED.password, role = EXCLUDED.role,
+			location_id = EXCLUDED.location_id`,
+		user.ID, user.NIK, user.Nama, user.Whatsapp, user.Email, user.Password, user.Role, user.CreatedAt, user.LocationID)
+	return userConstraintError(err)
+}
+
+func (s *PostgresStore) UpdateUser(id string, fn func(*models.User) error) (models.User, error) {
+	var user models.User
+	err := s.inTx(func(tx *sql.Tx) error {
+		var err error
+		user, err = scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1 FOR UPDATE`, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE users SET nik = $2, nama = $3, whatsapp = $4, email = $5, password = $6, role = $7,
+				location_id = $8
+			WHERE id = $1`,
+			user.ID, user.NIK, user.Nama, user.Whatsapp, user.Email, user.Password, user.Role, user.LocationID)
+		return userConstraintError(err)
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// userConstraintError maps unique violations on users to the Store's
+// duplicate errors.
+func userConstraintError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return err
+	}
+	switch pgErr.ConstraintName {
+	case "users_nik_key":
+		return ErrDuplicateNIK
+	case "users_email_key":
+		return ErrDuplicateEmail
+	case "users_whatsapp_key":
+		return ErrDuplicateWhatsapp
+	}
+	return err
+}
+
+// Tickets
+
+const ticketColumns = `id, user_id, location_id, location_name, ticket_number, code, time_slot, date, status,
+	created_at, cancelled_at, cancelled_by, redeemed_at, redeemed_by, no_show_at, no_show_by, expired_at`
+
+func scanTicket(row rowScanner) (models.Ticket, error) {
+	var t models.Ticket
+	err := row.Scan(&t.ID, &t.UserID, &t.LocationID, &t.LocationName, &t.TicketNumber, &t.Code, &t.TimeSlot, &t.Date, &t.Status,
+		&t.CreatedAt, &t.CancelledAt, &t.CancelledBy, &t.RedeemedAt, &t.RedeemedBy, &t.NoShowAt, &t.NoShowBy, &t.ExpiredAt)
+	return t, err
+}
+
+func ticketArgs(t models.Ticket) []any {
+	return []any{t.ID, t.UserID, t.LocationID, t.LocationName, t.TicketNumber, t.Code, t.TimeSlot, t.Date, t.Status,
+		t.CreatedAt, t.CancelledAt, t.CancelledBy, t.RedeemedAt, t.RedeemedBy, t.NoShowAt, t.NoShowBy, t.ExpiredAt}
+}
+
+const upsertTicket = `
+	INSERT INTO tickets (` + ticketColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+	ON CONFLICT (id) DO UPDATE SET
+		user_id = EXCLUDED.user_id, location_id = EXCLUDED.location_id, location_name = EXCLUDED.location_name,
+		ticket_number = EXCLUDED.ticket_number, code = EXCLUDED.code, time_slot = EXCLUDED.time_slot,
+		date = EXCLUDED.date, status = EXCLUDED.status, created_at = EXCLUDED.created_at,
+		cancelled_at = EXCLUDED.cancelled_at, cancelled_by = EXCLUDED.cancelled_by,
+		redeemed_at = EXCLUDED.redeemed_at, redeemed_by = EXCLUDED.redeemed_by,
+		no_show_at = EXCLUDED.no_show_at, no_show_by = EXCLUDED.no_show_by, expired_at = EXCLUDED.expired_at`
+
+func (s *PostgresStore) GetTicket(id string) (models.Ticket, bool) {
+	ticket, err := scanTicket(s.db.QueryRowContext(ctx, `SELECT `+ticketColumns+` FROM tickets WHERE id = $1`, id))
+	return ticket, found("ticket", err)
+}
+
+func (s *PostgresStore) ListTickets() []models.Ticket {
+	return s.queryTickets(`SELECT ` + ticketColumns + ` FROM tickets`)
+}
+
+func (s *PostgresStore) TicketsByUser(userID string) []models.Ticket {
+	return s.queryTickets(`SELECT `+ticketColumns+` FROM tickets WHERE user_id = $1`, userID)
+}
+
+func (s *PostgresStore) queryTickets(query string, args ...any) []models.Ticket {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("store: ticket query failed: %v", err)
+		return nil
+	}
+	defer rows.Close()
+	var tickets []models.Ticket
+	for rows.Next() {
+		ticket, err := scanTicket(rows)
+		if err != nil {
+			log.Printf("store: ticket scan failed: %v", err)
+			return nil
+		}
+		tickets = append(tickets, ticket)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("store: ticket query failed: %v", err)
+		return nil
+	}
+	return tickets
+}
+
+func (s *PostgresStore) SaveTicket(ticket models.Ticket) error {
+	_, err := s.db.ExecContext(ctx, upsertTicket, ticketArgs(ticket)...)
+	return err
+}
+
+func (s *PostgresStore) UpdateTicket(id string, fn func(*models.Ticket) error) (models.Ticket, error) {
+	var ticket models.Ticket
+	err := s.inTx(func(tx *sql.Tx) error {
+		var err error
+		ticket, err = scanTicket(tx.QueryRowContext(ctx, `SELECT `+ticketColumns+` FROM tickets WHERE id = $1 FOR UPDATE`, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(&ticket); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, upsertTicket, ticketArgs(ticket)...)
+		return err
+	})
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	return ticket, nil
+}
+
+// Locations
+
+const locationColumns = `id, name, quota, region, enabled, slots, gate_open, gate_close, created_at, updated_at, quota_reset_at`
+
+func scanLocation(row rowScanner) (models.Location, error) {
+	var l models.Location
+	var slots []byte
+	err := row.Scan(&l.ID, &l.Name, &l.Quota, &l.Region, &l.Enabled, &slots, &l.GateOpen, &l.GateClose, &l.CreatedAt, &l.UpdatedAt, &l.QuotaResetAt)
+	if err != nil {
+		return l, err
+	}
+	return l, json.Unmarshal(slots, &l.Slots)
+}
+
+func locationArgs(l models.Location) ([]any, error) {
+	slots, err := json.Marshal(l.Slots)
+	if err != nil {
+		return nil, err
+	}
+	return []any{l.ID, l.Name, l.Quota, l.Region, l.Enabled, string(slots), l.GateOpen, l.GateClose, l.CreatedAt, l.UpdatedAt, l.QuotaResetAt}, nil
+}
+
+func (s *PostgresStore) GetLocation(id string) (models.Location, bool) {
+	location, err := scanLocation(s.db.QueryRowContext(ctx, `SELECT `+locationColumns+` FROM locations WHERE id = $1`, id))
+	return location, found("location", err)
+}
+
+func (s *PostgresStore) ListLocations() []models.Location {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+locationColumns+` FROM locations ORDER BY id`)
+	if err != nil {
+		log.Printf("store: location query failed: %v", err)
+		return nil
+	}
+	defer rows.Close()
+	var locations []models.Location
+	for rows.Next() {
+		location, err := scanLocation(rows)
+		if err != nil {
+			log.Printf("store: location scan failed: %v", err)
+			return nil
+		}
+		locations = append(locations, location)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("store: location query failed: %v", err)
+		return nil
+	}
+	return locations
+}
+
+func (s *PostgresStore) AddLocation(location models.Location) (bool, error) {
+	args, err := locationArgs(location)
+	if err != nil {
+		return false, err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO locations (`+locationColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (id) DO NOTHING`, args...)
+	if err != nil {
+		return false, err
+	}
+	added, err := result.RowsAffected()
+	return added == 1, err
+}
+
+func (s *PostgresStore) UpdateLocation(id string, fn func(*models.Location) error) (models.Location, error) {
+	var location models.Location
+	err := s.inTx(func(tx *sql.Tx) error {
+		var err error
+		location, err = scanLocation(tx.QueryRowContext(ctx, `SELECT `+locationColumns+` FROM locations WHERE id = $1 FOR UPDATE`, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(&location); err != nil {
+			return err
+		}
+		args, err := locationArgs(location)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE locations SET name = $2, quota = $3, region = $4, enabled = $5, slots = $6,
+				gate_open = $7, gate_close = $8, created_at = $9, updated_at = $10, quota_reset_at = $11
+			WHERE id = $1`, args...)
+		return err
+	})
+	if err != nil {
+		return models.Location{}, err
+	}
+	return location, nil
+}
+
+// Sequences
+
+func (s *PostgresStore) Sequence(key string) int64 {
+	var value int64
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM sequences WHERE key = $1`, key).Scan(&value)
+	found("sequence", err)
+	return value
+}
+
+func (s *PostgresStore) NextSequence(key string) (int64, error) {
+	var value int64
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO sequences (key, value) VALUES ($1, 1)
+		ON CONFLICT (key) DO UPDATE SET value = sequences.value + 1
+		RETURNING value`, key).Scan(&value)
+	return value, err
+}
+
+func (s *PostgresStore) RaiseSequence(key string, n int64) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO sequences (key, value) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET value = GREATEST(sequences.value, EXCLUDED.value)`, key, n)
+	return err
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"war-ticket-engine/models"
+)
+
+// walRecord is one line of the JSON store's write-ahead log. Each record
+// carries the full new value of exactly one entry (there are no deletes),
+// so replaying a record twice is harmless. Version is the store version
+// the change produced; records already covered by the snapshot are
+// skipped on replay.
+type walRecord struct {
+	Version  uint64           `json:"v"`
+	User     *models.User     `json:"user,omitempty"`
+	Ticket   *models.Ticket   `json:"ticket,omitempty"`
+	Location *models.Location `json:"location,omitempty"`
+	Sequence *walSequence     `json:"sequence,omitempty"`
+}
+
+// pendingRecord is an encoded log record waiting for the flusher.
+type pendingRecord struct {
+	version uint64
+	raw     []byte
+}
+
+type walSequence struct {
+	Key   string `json:"key"`
+	Value int64  `json:"value"`
+}
+
+func walPath(path string) string {
+	return path + ".wal"
+}
+
+// apply stores the record's value. Callers must hold the write lock and
+// rebuild userTickets afterwards.
+func (db *JSONStore) apply(rec walRecord) {
+	switch {
+	case rec.User != nil:
+		db.Users[rec.User.ID] = *rec.User
+	case rec.Ticket != nil:
+		db.Tickets[rec.Ticket.ID] = *rec.Ticket
+	case rec.Location != nil:
+		db.Locations[rec.Location.ID] = *rec.Location
+	case rec.Sequence != nil:
+		db.Sequences[rec.Sequence.Key] = rec.Sequence.Value
+	}
+	if rec.Version > db.Version {
+		db.Version = rec.Version
+	}
+}
+
+// replayWAL applies the log records newer than the snapshot and returns
+// how many it found. A torn last line, left by a crash in the middle of
+// an append, is cut off; damage anywhere else is an error. Callers must
+// hold the write lock.
+func (db *JSONStore) replayWAL() (int, error) {
+	path := walPath(db.path)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	snapshot := db.Version
+	reader := bufio.NewReader(f)
+	var good int64
+	records := 0
+	for line := 1; ; line++ {
+		raw, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(raw)) > 0 {
+				return records, db.dropTornRecord(path, good)
+			}
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+
+		var rec walRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+				return records, db.dropTornRecord(path, good)
+			}
+			return records, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		good += int64(len(raw))
+		records++
+		if rec.Version <= snapshot {
+			continue
+		}
+		if db.SchemaVersion < SchemaVersion {
+			upgraded, err := db.upgradeWALRecord(raw)
+			if err != nil {
+				return records, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+			rec = walRecord{}
+			if err := json.Unmarshal(upgraded, &rec); err != nil {
+				return records, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+		}
+		db.apply(rec)
+	}
+}
+
+// dropTornRecord cuts a torn last record off the log. A read-only load
+// just ignores it: the owning process may still be writing it.
+func (db *JSONStore) dropTornRecord(path string, size int64) error {
+	if db.readOnly {
+		return nil
+	}
+	log.Printf("store: dropping torn record at end of %s", path)
+	return os.Truncate(path, size)
+}
+
+// appendWAL writes a batch of encoded records with a single fsync. On
+// failure the log is cut back to its previous end so that no partial
+// record is left in front of later appends. Only the flusher calls it.
+func (db *JSONStore) appendWAL(batch [][]byte) error {
+	var buf bytes.Buffer
+	for _, raw := range batch {
+		buf.Write(raw)
+		buf.WriteByte('\n')
+	}
+	_, err := db.wal.Write(buf.Bytes())
+	if err == nil {
+		err = db.wal.Sync()
+	}
+	if err != nil {
+		if truncErr := db.wal.Truncate(db.walSize); truncErr != nil {
+			log.Printf("store: cutting back %s failed: %v", walPath(db.path), truncErr)
+		}
+		return err
+	}
+	db.walSize += int64(buf.Len())
+	db.walRecords += len(batch)
+	return nil
+}
+
+// writeSnapshot replaces the database file with data and empties the
+// log. If emptying fails the old records stay behind, but they are older
+// than the snapshot and so skipped on replay. Only the flusher calls it.
+func (db *JSONStore) writeSnapshot(data []byte) error {
+	if err := writeFileAtomic(db.path, data, 0644); err != nil {
+		return err
+	}
+	if err := db.wal.Truncate(0); err != nil {
+		return err
+	}
+	if err := db.wal.Sync(); err != nil {
+		return err
+	}
+	db.walSize, db.walRecords = 0, 0
+	return nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// writeLoggedStore stores three users with compaction held off, so they
+// only reach the log, and returns the database path. The store is left
+// open, as if the process had crashed.
+func writeLoggedStore(t *testing.T) string {
+	t.Helper()
+	t.Setenv("DATABASE_WAL_COMPACT_RECORDS", "1000")
+	db, path := newTestJSONStore(t)
+	t.Cleanup(func() { db.Close() })
+	for _, id := range []string{"u1", "u2", "u3"} {
+		if err := db.SetUser(testUser(id, id)); err != nil {
+			t.Fatalf("SetUser: %v", err)
+		}
+	}
+	return path
+}
+
+func appendToFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestJSONStoreReplaysLog(t *testing.T) {
+	path := writeLoggedStore(t)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("snapshot written before compaction: %v", err)
+	}
+
+	db := newJSONStore(path)
+	if err := db.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for _, id := range []string{"u1", "u2", "u3"} {
+		if _, ok := db.GetUser(id); !ok {
+			t.Errorf("user %s not replayed from the log", id)
+		}
+	}
+	if user, ok := db.GetUserByNIK("u2"); !ok || user.ID != "u2" {
+		t.Errorf("replayed user not indexed by NIK: %+v", user)
+	}
+}
+
+func TestJSONStoreTornLogRecords(t *testing.T) {
+	tests := []struct {
+		name     string
+		tail     string
+		readOnly bool
+		wantErr  bool
+		wantCut  bool
+	}{
+		{"clean end", "", false, false, false},
+		{"torn last record", `{"v":99,"user":{"id":"u9"`, false, false, true},
+		{"torn last line with newline", "{\"v\":99,\"us\n", false, false, true},
+		{"torn last record, read only", `{"v":99,"user":{"id":"u9"`, true, false, false},
+		{"damage before the last record", "garbage\n{\"v\":99}\n", false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeLoggedStore(t)
+			log := walPath(path)
+			good := fileSize(t, log)
+			appendToFile(t, log, tt.tail)
+
+			db := newJSONStore(path)
+			db.readOnly = tt.readOnly
+			err := db.Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := len(db.Users); got != 3 {
+				t.Errorf("%d users loaded, want 3", got)
+			}
+			want := good + int64(len(tt.tail))
+			if tt.wantCut {
+				want = good
+			}
+			if got := fileSize(t, log); got != want {
+				t.Errorf("log size %d after load, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestJSONStoreSkipsRecordsCoveredBySnapshot(t *testing.T) {
+	db, path := newTestJSONStore(t)
+	user := testUser("u1", "1")
+	user.Nama = "New"
+	if err := db.SetUser(user); err != nil {
+		t.Fatalf("SetUser: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// A record the snapshot already covers, left behind by a compaction
+	// that could not empty the log.
+	stale := user
+	stale.Nama = "Old"
+	raw, err := json.Marshal(walRecord{Version: 1, User: &stale})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, walPath(path), string(raw)+"\n")
+
+	reopened, err := NewJSONStore(path)
+	if err != nil {
+		t.Fatalf("NewJSONStore: %v", err)
+	}
+	defer reopened.Close()
+	if got, _ := reopened.GetUser("u1"); got.Nama != "New" {
+		t.Errorf("nama = %q after replay, want the snapshot's %q", got.Nama, "New")
+	}
+}
+
+func TestJSONStoreCompactsLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		records string
+		users   int
+		close   bool
+	}{
+		{"log reaches the record limit", "3", 7, false},
+		{"close", "1000", 4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DATABASE_WAL_COMPACT_RECORDS", tt.records)
+			db, path := newTestJSONStore(t)
+			for i := range tt.users {
+				id := string(rune('a' + i))
+				if err := db.SetUser(testUser(id, id)); err != nil {
+					t.Fatalf("SetUser: %v", err)
+				}
+			}
+			if tt.close {
+				if err := db.Close(); err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+				if size := fileSize(t, walPath(path)); size != 0 {
+					t.Errorf("log holds %d bytes after Close, want 0", size)
+				}
+			} else {
+				defer db.Close()
+				db.mu.Lock()
+				records := db.walRecords
+				db.mu.Unlock()
+				if records >= 3 {
+					t.Errorf("log holds %d records, want fewer than the limit of 3", records)
+				}
+			}
+
+			// The snapshot alone, without the log, must hold what was
+			// compacted into it.
+			snapshot := newJSONStore(path)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("no snapshot written: %v", err)
+			}
+			if err := snapshot.decodeSnapshot(data); err != nil {
+				t.Fatalf("decodeSnapshot: %v", err)
+			}
+			reopened := newJSONStore(path)
+			if err := reopened.Load(); err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if got := len(reopened.Users); got != tt.users {
+				t.Errorf("%d users after reload, want %d", got, tt.users)
+			}
+			if tt.close && len(snapshot.Users) != tt.users {
+				t.Errorf("snapshot holds %d users, want %d", len(snapshot.Users), tt.users)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"war-ticket-engine/models"
+)
+
+// Ticket codes use Crockford's base32 alphabet, which leaves out I, L, O
+// and U so codes read out over the counter are not misheard.
+const ticketCodeAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ticketCodeLength is the number of random symbols in a code (55 bits);
+// one check symbol follows.
+const ticketCodeLength = 11
+
+// ticketNumber formats a sequence number as LOCATION-YYMMDD-NNNN. The
+// sequence is unique per location and date, so the number is unique.
+func ticketNumber(locationID, date string, seq int64) string {
+	return fmt.Sprintf("%s-%s-%04d", strings.ToUpper(locationID), sequenceDate(date), seq)
+}
+
+// generateCode returns a random verification code with a Luhn mod 32
+// check symbol, grouped as XXXX-XXXX-XXXX.
+func generateCode() string {
+	raw := make([]byte, ticketCodeLength)
+	rand.Read(raw)
+	symbols := make([]byte, ticketCodeLength, ticketCodeLength+1)
+	for i, b := range raw {
+		symbols[i] = ticketCodeAlphabet[int(b)%len(ticketCodeAlphabet)]
+	}
+	symbols = append(symbols, ticketCodeAlphabet[luhnCheck(symbols)])
+	return string(symbols[0:4]) + "-" + string(symbols[4:8]) + "-" + string(symbols[8:])
+}
+
+// ValidTicketCode reports whether code is well formed and its check
+// symbol matches, so a mistyped code can be rejected without a lookup.
+// Codes of tickets issued before checksums existed are not recognised.
+func ValidTicketCode(code string) bool {
+	symbols := []byte(strings.ToUpper(strings.ReplaceAll(code, "-", "")))
+	if len(symbols) != ticketCodeLength+1 {
+		return false
+	}
+	for _, c := range symbols {
+		if strings.IndexByte(ticketCodeAlphabet, c) < 0 {
+			return false
+		}
+	}
+	last := len(symbols) - 1
+	return ticketCodeAlphabet[luhnCheck(symbols[:last])] == symbols[last]
+}
+
+// legacyTicketCode reports whether code has the form of the six hex
+// digit codes issued before checksums existed.
+func legacyTicketCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, c := range []byte(code) {
+		if strings.IndexByte("0123456789ABCDEF", c) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// luhnCheck returns the index of the Luhn mod N check symbol for symbols.
+func luhnCheck(symbols []byte) int {
+	n := len(ticketCodeAlphabet)
+	sum := 0
+	factor := 2
+	for i := len(symbols) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(ticketCodeAlphabet, symbols[i])
+		sum += addend/n + addend%n
+		factor = 3 - factor
+	}
+	return (n - sum%n) % n
+}
+
+// NewTicket builds an active ticket for user at location on date (YYYY-MM-DD)
+// in the time slot starting at slot (empty for the war), numbered from
+// the location's sequence for that date. It is shared by every path that
+// issues tickets so they number and code them alike.
+func NewTicket(redis *RedisService, store Store, user models.User, location models.Location, date, slot string) (models.Ticket, error) {
+	seq, err := nextTicketSequence(redis, store, location.ID, date)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return models.Ticket{
+		ID:           hex.EncodeToString(id),
+		UserID:       user.ID,
+		LocationID:   location.ID,
+		LocationName: location.Name,
+		TicketNumber: ticketNumber(location.ID, date, seq),
+		Code:         generateCode(),
+		TimeSlot:     slot,
+		Date:         date,
+		Status:       models.TicketActive,
+		CreatedAt:    time.Now(),
+	}, nil
+}
+
+// TicketExpiry is when the ticket can no longer be used: the end of its
+// time slot, or the end of its date when it has no slot.
+func TicketExpiry(store Store, ticket models.Ticket) (time.Time, error) {
+	day, err := time.ParseInLocation("2006-01-02", ticket.Date, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	endOfDay := day.AddDate(0, 0, 1)
+	if ticket.TimeSlot == "" {
+		return endOfDay, nil
+	}
+
+	location, exists := store.GetLocation(ticket.LocationID)
+	if !exists {
+		return endOfDay, nil
+	}
+	slot, exists := location.Slot(ticket.TimeSlot)
+	if !exists {
+		// The slot was edited since booking; the pass stays good for
+		// the day rather than locking the holder out.
+		return endOfDay, nil
+	}
+	return time.ParseInLocation("2006-01-02 15:04", ticket.Date+" "+slot.End, time.Local)
+}
+
+// TicketStatus is the ticket's status as shown to its owner. Active
+// tickets whose time has passed are reported as expired even before
+// ExpireTickets has stored that.
+func TicketStatus(store Store, ticket models.Ticket, now time.Time) string {
+	if ticket.Active() && ticketExpired(store, ticket, now) {
+		return models.TicketExpired
+	}
+	return ticket.CurrentStatus()
+}
+
+// ExpireTickets moves active tickets whose time has passed to expired
+// and returns how many it moved.
+func ExpireTickets(store Store, now time.Time) (int, error) {
+	expired := 0
+	for _, ticket := range store.ListTickets() {
+		if !ticket.Active() || !ticketExpired(store, ticket, now) {
+			continue
+		}
+		_, err := store.UpdateTicket(ticket.ID, func(t *models.Ticket) error {
+			return t.Transition(models.TicketExpired, now, "")
+		})
+		if errors.Is(err, models.ErrInvalidTransition) {
+			// Cancelled or redeemed since it was listed.
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+func ticketExpired(store Store, ticket models.Ticket, now time.Time) bool {
+	expiresAt, err := TicketExpiry(store, ticket)
+	return err == nil && now.After(expiresAt)
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"war-ticket-engine/models"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+var (
+	ErrPassInvalid = errors.New("invalid ticket pass")
+	ErrPassExpired = errors.New("ticket pass expired")
+)
+
+// TicketPass is what the QR code on a ticket carries. It is signed, so
+// staff can check a scanned pass without trusting the phone showing it.
+type TicketPass struct {
+	TicketID   string    `json:"ticket_id"`
+	Code       string    `json:"code"`
+	LocationID string    `json:"location_id"`
+	Date       string    `json:"date"`
+	TimeSlot   string    `json:"time_slot"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type TicketPassService struct {
+	signer tokenSigner
+	store  Store
+}
+
+func NewTicketPassService(store Store) *TicketPassService {
+	secret := readSecret("TICKET_PASS_SECRET")
+	return &TicketPassService{signer: newTokenSigner(secret), store: store}
+}
+
+// Sign returns the signed pass for ticket. It expires at the end of the
+// ticket's time slot, or at the end of its date when it has no slot.
+func (p *TicketPassService) Sign(ticket models.Ticket) (string, TicketPass, error) {
+	expiresAt, err := TicketExpiry(p.store, ticket)
+	if err != nil {
+		return "", TicketPass{}, err
+	}
+	pass := TicketPass{
+		TicketID:   ticket.ID,
+		Code:       ticket.Code,
+		LocationID: ticket.LocationID,
+		Date:       ticket.Date,
+		TimeSlot:   ticket.TimeSlot,
+		ExpiresAt:  expiresAt,
+	}
+	fields := []string{pass.TicketID, pass.Code, pass.LocationID, pass.Date, pass.TimeSlot}
+	for _, field := range fields {
+		if strings.ContainsAny(field, ",|") {
+			return "", TicketPass{}, ErrPassInvalid
+		}
+	}
+	return p.signer.sign(expiresAt.Unix(), "ticket_pass", strings.Join(fields, ",")), pass, nil
+}
+
+// Verify checks that payload is an authentic, unexpired pass for a well
+// formed ticket code.
+func (p *TicketPassService) Verify(payload string, now time.Time) (TicketPass, error) {
+	exp, kind, data, err := p.signer.parse(payload)
+	if err != nil || kind != "ticket_pass" {
+		return TicketPass{}, ErrPassInvalid
+	}
+	parts := strings.Split(data, ",")
+	if len(parts) != 5 {
+		return TicketPass{}, ErrPassInvalid
+	}
+	pass := TicketPass{
+		TicketID:   parts[0],
+		Code:       parts[1],
+		LocationID: parts[2],
+		Date:       parts[3],
+		TimeSlot:   parts[4],
+		ExpiresAt:  time.Unix(exp, 0),
+	}
+	if !ValidTicketCode(pass.Code) && !legacyTicketCode(pass.Code) {
+		return TicketPass{}, ErrPassInvalid
+	}
+	if now.After(pass.ExpiresAt) {
+		return pass, ErrPassExpired
+	}
+	return pass, nil
+}
+
+// RenderQRPNG encodes payload as a size x size pixel PNG QR code.
+func RenderQRPNG(payload string, size int) ([]byte, error) {
+	return qrcode.Encode(payload, qrcode.Medium, size)
+}
+
+// RenderQRSVG encodes payload as an SVG QR code, size pixels wide, with
+// one rect per dark module.
+func RenderQRSVG(payload string, size int) ([]byte, error) {
+	code, err := qrcode.New(payload, qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+	bitmap := code.Bitmap()
+	n := len(bitmap)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, n, n)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/>`, n, n)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, `<rect x="%d" y="%d" width="1" height="1"/>`, x, y)
+			}
+		}
+	}
+	b.WriteString(`</svg>`)
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validCode returns a fixed code with a correct check symbol.
+func validCode() string {
+	symbols := []byte("ABCDEFGHJKM")
+	symbols = append(symbols, ticketCodeAlphabet[luhnCheck(symbols)])
+	return string(symbols)
+}
+
+// mistype replaces the symbol at i with the next one in the alphabet.
+func mistype(symbols string, i int) string {
+	b := []byte(symbols)
+	b[i] = ticketCodeAlphabet[(strings.IndexByte(ticketCodeAlphabet, b[i])+1)%len(ticketCodeAlphabet)]
+	return string(b)
+}
+
+func TestValidTicketCode(t *testing.T) {
+	symbols := validCode()
+	code := symbols[0:4] + "-" + symbols[4:8] + "-" + symbols[8:]
+	swap := func(i int) string {
+		b := []byte(symbols)
+		b[i], b[i+1] = b[i+1], b[i]
+		return string(b)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"generated", code, true},
+		{"without dashes", symbols, true},
+		{"lower case", strings.ToLower(code), true},
+		{"first symbol mistyped", mistype(symbols, 0), false},
+		{"check symbol mistyped", mistype(symbols, ticketCodeLength), false},
+		{"symbols swapped", swap(3), false},
+		{"too short", symbols[:ticketCodeLength], false},
+		{"too long", symbols + "0", false},
+		{"letter outside the alphabet", "I" + symbols[1:], false},
+		{"legacy hex code", "A1B2C3", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		if got := ValidTicketCode(tt.code); got != tt.want {
+			t.Errorf("%s: ValidTicketCode(%q) = %v, want %v", tt.name, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestGeneratedTicketCodesAreValid(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		if code := generateCode(); !ValidTicketCode(code) {
+			t.Fatalf("generateCode() = %q, which fails its own checksum", code)
+		}
+	}
+}
+
+func TestTicketPassVerifyRejectsMalformedCodes(t *testing.T) {
+	passes := &TicketPassService{signer: newTokenSigner("secret")}
+	exp := time.Now().Add(time.Hour).Unix()
+	code := validCode()
+
+	tests := []struct {
+		name string
+		code string
+		want error
+	}{
+		{"checksummed code", code, nil},
+		{"legacy code", "A1B2C3", nil},
+		{"mistyped code", mistype(code, 5), ErrPassInvalid},
+		{"empty code", "", ErrPassInvalid},
+	}
+	for _, tt := range tests {
+		payload := passes.signer.sign(exp, "ticket_pass", strings.Join([]string{"t1", tt.code, "juanda", "2026-01-02", "09:00"}, ","))
+		if _, err := passes.Verify(payload, time.Now()); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"war-ticket-engine/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ticketWritesKey     = "ticket_writes"
+	ticketProcessingKey = "ticket_writes:processing"
+	ticketPendingKey    = "ticket_writes:pending"
+)
+
+// TicketWriter persists tickets behind the request path. Enqueue returns
+// once the ticket is durably queued (a Redis list, or a fsynced journal
+// file without Redis); a background worker then writes it to the
+// database. Items are only removed from the queue after the database
+// write succeeded, and anything left over from a crash is replayed on
+// Start, so an accepted ticket is never lost.
+type TicketWriter struct {
+	redis       *RedisService
+	store       Store
+	journalPath string
+	stop        chan struct{}
+	done        chan struct{}
+
+	// Fallback state when Redis is unavailable
+	mu      sync.Mutex
+	pending map[string]models.Ticket
+	wake    chan struct{}
+}
+
+func NewTicketWriter(redis *RedisService, store Store) *TicketWriter {
+	return &TicketWriter{
+		redis:       redis,
+		store:       store,
+		journalPath: ticketJournalPath(),
+		pending:     make(map[string]models.Ticket),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+func ticketJournalPath() string {
+	if path := strings.TrimSpace(os.Getenv("TICKET_JOURNAL_PATH")); path != "" {
+		return path
+	}
+	return "ticket_journal.jsonl"
+}
+
+// QueuedTickets reads, from outside the engine, the tickets it accepted
+// but has not written to the store yet: the Redis queue when Redis is
+// up, otherwise the journal. The journal may still list tickets that
+// were already written.
+func QueuedTickets() ([]models.Ticket, error) {
+	client := newRedisClient()
+	defer client.Close()
+	if client.Ping(ctx).Err() == nil {
+		entries, err := client.HGetAll(ctx, ticketPendingKey).Result()
+		if err != nil {
+			return nil, err
+		}
+		tickets := make([]models.Ticket, 0, len(entries))
+		for _, raw := range entries {
+			var ticket models.Ticket
+			if err := json.Unmarshal([]byte(raw), &ticket); err == nil {
+				tickets = append(tickets, ticket)
+			}
+		}
+		return tickets, nil
+	}
+
+	f, err := os.Open(ticketJournalPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var tickets []models.Ticket
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ticket models.Ticket
+		// A torn last line is being written right now; skip it.
+		if err := json.Unmarshal(scanner.Bytes(), &ticket); err == nil {
+			tickets = append(tickets, ticket)
+		}
+	}
+	return tickets, scanner.Err()
+}
+
+// Enqueue queues the ticket for persistence.
+func (w *TicketWriter) Enqueue(ticket models.Ticket) error {
+	raw, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+
+	if w.redis.IsConnected() {
+		_, err := w.redis.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, ticketPendingKey, ticket.ID, raw)
+			pipe.RPush(ctx, ticketWritesKey, raw)
+			return nil
+		})
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.appendJournal(raw); err != nil {
+		return err
+	}
+	w.pending[ticket.ID] = ticket
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pending returns a ticket that was accepted but not yet written to the
+// database, so it can be looked up right after a booking.
+func (w *TicketWriter) Pending(id string) (models.Ticket, bool) {
+	if w.redis.IsConnected() {
+		raw, err := w.redis.Client.HGet(ctx, ticketPendingKey, id).Bytes()
+		if err != nil {
+			return models.Ticket{}, false
+		}
+		var ticket models.Ticket
+		if err := json.Unmarshal(raw, &ticket); err != nil {
+			return models.Ticket{}, false
+		}
+		return ticket, true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ticket, ok := w.pending[id]
+	return ticket, ok
+}
+
+// PendingTickets returns all tickets still waiting to be written.
+func (w *TicketWriter) PendingTickets() ([]models.Ticket, error) {
+	if w.redis.IsConnected() {
+		entries, err := w.redis.Client.HGetAll(ctx, ticketPendingKey).Result()
+		if err != nil {
+			return nil, err
+		}
+		tickets := make([]models.Ticket, 0, len(entries))
+		for _, raw := range entries {
+			var ticket models.Ticket
+			if err := json.Unmarshal([]byte(raw), &ticket); err == nil {
+				tickets = append(tickets, ticket)
+			}
+		}
+		return tickets, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	tickets := make([]models.Ticket, 0, len(w.pending))
+	for _, ticket := range w.pending {
+		tickets = append(tickets, ticket)
+	}
+	return tickets, nil
+}
+
+// Start recovers tickets left over from a previous run and starts the
+// background worker.
+func (w *TicketWriter) Start() {
+	if w.redis.IsConnected() {
+		// Tickets a crashed worker had taken but not written go back to
+		// the front of the queue. A replay never overwrites a stored
+		// ticket (see persist), so a ticket cancelled since is not
+		// brought back.
+		for {
+			err := w.redis.Client.LMove(ctx, ticketProcessingKey, ticketWritesKey, "RIGHT", "LEFT").Err()
+			if err != nil {
+				if err != redis.Nil {
+					log.Printf("ticket writer recovery failed: %v", err)
+				}
+				break
+			}
+		}
+	} else if err := w.replayJournal(); err != nil {
+		log.Printf("ticket journal replay failed: %v", err)
+	}
+
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.run()
+}
+
+// Stop waits for the worker to finish the ticket it is writing.
+func (w *TicketWriter) Stop() {
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+}
+
+func (w *TicketWriter) run() {
+	defer close(w.done)
+	for {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		var err error
+		if w.redis.IsConnected() {
+			err = w.drainRedis()
+		} else {
+			err = w.drainMemory()
+		}
+		if err != nil {
+			log.Printf("ticket write failed, retrying: %v", err)
+			select {
+			case <-w.stop:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+func (w *TicketWriter) drainRedis() error {
+	raw, err := w.redis.Client.BLMove(ctx, ticketWritesKey, ticketProcessingKey, "LEFT", "RIGHT", time.Second).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var ticket models.Ticket
+	if err := json.Unmarshal([]byte(raw), &ticket); err != nil {
+		// A malformed entry can never succeed; drop it rather than
+		// blocking the queue forever.
+		log.Printf("dropping malformed ticket write %q: %v", raw, err)
+		return w.redis.Client.LRem(ctx, ticketProcessingKey, 1, raw).Err()
+	}
+	if err := w.persist(ticket); err != nil {
+		w.redis.Client.LMove(ctx, ticketProcessingKey, ticketWritesKey, "RIGHT", "LEFT")
+		return err
+	}
+
+	_, err = w.redis.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, ticketProcessingKey, 1, raw)
+		pipe.HDel(ctx, ticketPendingKey, ticket.ID)
+		return nil
+	})
+	return err
+}
+
+func (w *TicketWriter) drainMemory() error {
+	select {
+	case <-w.stop:
+		return nil
+	case <-w.wake:
+	case <-time.After(time.Second):
+	}
+
+	w.mu.Lock()
+	batch := make([]models.Ticket, 0, len(w.pending))
+	for _, ticket := range w.pending {
+		batch = append(batch, ticket)
+	}
+	w.mu.Unlock()
+
+	for _, ticket := range batch {
+		if err := w.persist(ticket); err != nil {
+			return err
+		}
+		// Drop the written ticket from the journal right away, so it is
+		// not replayed after a restart even if the queue never empties.
+		w.mu.Lock()
+		delete(w.pending, ticket.ID)
+		err := w.rewriteJournal()
+		w.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// persist writes a queued ticket unless the store already has it. Queue
+// entries are replayed after a crash, and the stored ticket may have
+// been cancelled, redeemed or expired since; writing the queued copy
+// would make it active again.
+func (w *TicketWriter) persist(ticket models.Ticket) error {
+	if _, exists := w.store.GetTicket(ticket.ID); exists {
+		return nil
+	}
+	return w.store.SaveTicket(ticket)
+}
+
+// rewriteJournal replaces the journal with the tickets still pending.
+// Callers must hold w.mu.
+func (w *TicketWriter) rewriteJournal() error {
+	var data []byte
+	for _, ticket := range w.pending {
+		raw, err := json.Marshal(ticket)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, raw...), '\n')
+	}
+	return writeFileAtomic(w.journalPath, data, 0644)
+}
+
+// appendJournal writes one ticket to the journal and syncs it to disk.
+// Callers must hold w.mu.
+func (w *TicketWriter) appendJournal(raw []byte) error {
+	f, err := os.OpenFile(w.journalPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(raw, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// replayJournal queues tickets that were journaled but not yet written
+// when the process stopped.
+func (w *TicketWriter) replayJournal() error {
+	f, err := os.Open(w.journalPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ticket models.Ticket
+		if err := json.Unmarshal(scanner.Bytes(), &ticket); err != nil {
+			// A torn last line from a crash mid-write; the request that
+			// wrote it never got a success response.
+			log.Printf("skipping unreadable ticket journal entry: %v", err)
+			continue
+		}
+		w.pending[ticket.ID] = ticket
+	}
+	if len(w.pending) > 0 {
+		log.Printf("replaying %d journaled tickets", len(w.pending))
+		w.wake <- struct{}{}
+	}
+	return scanner.Err()
+}
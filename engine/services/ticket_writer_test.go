@@ -0,0 +1,70 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"war-ticket-engine/models"
+)
+
+func TestTicketWriterReplaysJournalWithoutOverwriting(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored string // status of the stored copy, empty when not stored
+		want   string
+	}{
+		{"not stored yet", "", models.TicketActive},
+		{"cancelled since", models.TicketCancelled, models.TicketCancelled},
+		{"redeemed since", models.TicketRedeemed, models.TicketRedeemed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := newTestJSONStore(t)
+			queued := testTicket("t1", "u1")
+			queued.Status = models.TicketActive
+			if tt.stored != "" {
+				stored := queued
+				stored.Status = tt.stored
+				if err := db.SaveTicket(stored); err != nil {
+					t.Fatalf("SaveTicket: %v", err)
+				}
+			}
+
+			w := NewTicketWriter(newTestRedis(), db)
+			w.journalPath = filepath.Join(t.TempDir(), "ticket_journal.jsonl")
+			raw, err := json.Marshal(queued)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(w.journalPath, append(raw, '\n'), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			w.Start()
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				if _, pending := w.Pending(queued.ID); !pending {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("journaled ticket was not written")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			w.Stop()
+
+			ticket, exists := db.GetTicket(queued.ID)
+			if !exists {
+				t.Fatal("ticket not stored")
+			}
+			if ticket.Status != tt.want {
+				t.Errorf("status = %q after replay, want %q", ticket.Status, tt.want)
+			}
+			if info, err := os.Stat(w.journalPath); err != nil || info.Size() != 0 {
+				t.Errorf("journal not emptied after the write: %v", err)
+			}
+		})
+	}
+}
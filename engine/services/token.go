@@ -0,0 +1,113 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var errInvalidToken = errors.New("invalid token")
+
+// signingSecrets are the environment variables holding the keys that
+// sign tokens handed out to clients.
+var signingSecrets = []string{"SESSION_SECRET", "CAPTCHA_SECRET", "QUEUE_SECRET", "GATE_BYPASS_SECRET", "TICKET_PASS_SECRET"}
+
+// devSecret signs tokens when a secret is unset in DEV_MODE. Anyone can
+// forge tokens signed with it.
+const devSecret = "dev-secret"
+
+func devMode() bool {
+	return strings.EqualFold(strings.TrimSpace(os.Getenv("DEV_MODE")), "true")
+}
+
+// CheckSecrets reports the signing secrets that are unset. The server
+// must not start without them unless DEV_MODE=true.
+func CheckSecrets() error {
+	if devMode() {
+		return nil
+	}
+	var missing []string
+	for _, key := range signingSecrets {
+		if strings.TrimSpace(os.Getenv(key)) == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s not set (set DEV_MODE=true to use an insecure development secret)", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// readSecret returns the secret in the environment variable key, falling
+// back to devSecret, which CheckSecrets only allows in DEV_MODE.
+func readSecret(key string) string {
+	secret := strings.TrimSpace(os.Getenv(key))
+	if secret == "" {
+		log.Printf("⚠️  %s not set, signing with the insecure development secret", key)
+		return devSecret
+	}
+	return secret
+}
+
+// tokenSigner produces compact HMAC-signed tokens of the form
+// base64(exp|kind|data|sig). It is shared by every service that hands
+// out stateless tokens so they all verify the same way.
+type tokenSigner struct {
+	secret []byte
+}
+
+func newTokenSigner(secret string) tokenSigner {
+	return tokenSigner{secret: []byte(secret)}
+}
+
+func (s tokenSigner) sign(exp int64, kind, data string) string {
+	payload := fmt.Sprintf("%d|%s|%s", exp, kind, data)
+	token := payload + "|" + s.mac(payload)
+	return base64.RawURLEncoding.EncodeToString([]byte(token))
+}
+
+func (s tokenSigner) parse(token string) (int64, string, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(token))
+	if err != nil {
+		return 0, "", "", errInvalidToken
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 4 {
+		return 0, "", "", errInvalidToken
+	}
+	exp, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", "", errInvalidToken
+	}
+	kind := parts[1]
+	data := parts[2]
+	sig := parts[3]
+
+	payload := fmt.Sprintf("%d|%s|%s", exp, kind, data)
+	if !hmac.Equal([]byte(s.mac(payload)), []byte(sig)) {
+		return 0, "", "", errInvalidToken
+	}
+	return exp, kind, data, nil
+}
+
+func (s tokenSigner) mac(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTokenSignerParse(t *testing.T) {
+	signer := newTokenSigner("secret")
+	valid := signer.sign(1700000000, "session", "u1")
+	raw, _ := base64.RawURLEncoding.DecodeString(valid)
+	reencode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", valid, true},
+		{"surrounding spaces", "  " + valid + "\n", true},
+		{"other secret", newTokenSigner("other").sign(1700000000, "session", "u1"), false},
+		{"changed data", reencode(strings.Replace(string(raw), "|u1|", "|u2|", 1)), false},
+		{"changed kind", reencode(strings.Replace(string(raw), "|session|", "|captcha|", 1)), false},
+		{"changed expiry", reencode("1800000000" + string(raw)[len("1700000000"):]), false},
+		{"data with separator", signer.sign(1700000000, "session", "u1|admin"), false},
+		{"missing signature", reencode("1700000000|session|u1"), false},
+		{"expiry not a number", reencode("soon|session|u1|sig"), false},
+		{"not base64", "!!!", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		exp, kind, data, err := signer.parse(tt.token)
+		if !tt.ok {
+			if !errors.Is(err, errInvalidToken) {
+				t.Errorf("%s: parse = %v, want errInvalidToken", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || exp != 1700000000 || kind != "session" || data != "u1" {
+			t.Errorf("%s: parse = %d, %q, %q, %v", tt.name, exp, kind, data, err)
+		}
+	}
+}
+
+func TestCheckSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		devMode string
+		unset   []string
+		value   string
+		wantErr bool
+	}{
+		{"all set", "", nil, "", false},
+		{"one missing", "", []string{"QUEUE_SECRET"}, "", true},
+		{"blank counts as missing", "", []string{"SESSION_SECRET"}, "  ", true},
+		{"missing in dev mode", "true", []string{"QUEUE_SECRET", "TICKET_PASS_SECRET"}, "", false},
+		{"dev mode is not any value", "1", []string{"QUEUE_SECRET"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DEV_MODE", tt.devMode)
+			for _, key := range signingSecrets {
+				t.Setenv(key, "set")
+			}
+			for _, key := range tt.unset {
+				t.Setenv(key, tt.value)
+			}
+			err := CheckSecrets()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckSecrets = %v, want error %v", err, tt.wantErr)
+			}
+			for _, key := range tt.unset {
+				if tt.wantErr && !strings.Contains(err.Error(), key) {
+					t.Errorf("error %q does not name %s", err, key)
+				}
+			}
+		})
+	}
+}
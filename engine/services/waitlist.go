@@ -0,0 +1,795 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"war-ticket-engine/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrWaitlistJoined = errors.New("already on the waitlist")
+	ErrOfferNotFound  = errors.New("waitlist offer not found")
+)
+
+const (
+	waitlistIndexKey  = "waitlist:index"
+	waitlistOffersKey = "waitlist:offers"
+)
+
+// WaitlistService keeps a FIFO waitlist per location, date and time
+// slot. When a seat comes free (cancellation or capacity increase; a
+// no-show's slot has already started, so its seat stays used) the next
+// waiting user either gets a ticket right away
+// (WAITLIST_AUTO_ISSUE=true) or a claim offer that holds the seat for
+// WAITLIST_OFFER_TTL_SECONDS. Unclaimed or declined offers move on to
+// the next user; the seat only returns to the public pool once the
+// waitlist is empty. Held seats are recorded as reservations, so the
+// reconciler accounts for them.
+type WaitlistService struct {
+	redis     *RedisService
+	store     Store
+	notifier  Notifier
+	autoIssue bool
+	offerTTL  time.Duration
+	stop      chan struct{}
+
+	// handout serializes seat hand-outs so a released seat is given to
+	// exactly one user.
+	handout sync.Mutex
+	// sending tracks notifications still being delivered.
+	sending sync.WaitGroup
+
+	// Fallback state when Redis is unavailable
+	mu     sync.Mutex
+	queues map[string][]models.WaitlistEntry
+	offers map[string]models.WaitlistOffer
+}
+
+// WaitlistPosition is a user's entry plus their place in line (1 is
+// next).
+type WaitlistPosition struct {
+	models.WaitlistEntry
+	Position int64 `json:"position"`
+}
+
+// Joins atomically so a user is queued at most once per slot.
+// Returns the queue length, or -1 when the user is already waiting.
+var joinWaitlistScript = redis.NewScript(`
+if redis.call('SADD', KEYS[2], ARGV[1]) == 0 then
+	return -1
+end
+redis.call('RPUSH', KEYS[1], ARGV[2])
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+redis.call('EXPIRE', KEYS[2], ARGV[4])
+redis.call('SADD', KEYS[3], ARGV[3])
+redis.call('SADD', KEYS[4], ARGV[3])
+return redis.call('LLEN', KEYS[1])
+`)
+
+func NewWaitlistService(redis *RedisService, store Store, notifier Notifier) *WaitlistService {
+	return &WaitlistService{
+		redis:     redis,
+		store:     store,
+		notifier:  notifier,
+		autoIssue: strings.EqualFold(strings.TrimSpace(os.Getenv("WAITLIST_AUTO_ISSUE")), "true"),
+		offerTTL:  readSeconds("WAITLIST_OFFER_TTL_SECONDS", 600),
+		queues:    make(map[string][]models.WaitlistEntry),
+		offers:    make(map[string]models.WaitlistOffer),
+	}
+}
+
+// Start expires unclaimed offers until Stop is called.
+func (w *WaitlistService) Start() {
+	w.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case now := <-ticker.C:
+				w.expireOffers(now)
+			}
+		}
+	}()
+}
+
+// Stop ends the offer sweep and waits for notifications in flight.
+func (w *WaitlistService) Stop() {
+	if w.stop != nil {
+		close(w.stop)
+	}
+	w.sending.Wait()
+}
+
+// Join puts the user at the end of the slot's waitlist and returns their
+// position.
+func (w *WaitlistService) Join(userID, locationID, date, slot string) (WaitlistPosition, error) {
+	entry := models.WaitlistEntry{
+		UserID:     userID,
+		LocationID: locationID,
+		Date:       date,
+		TimeSlot:   slot,
+		JoinedAt:   time.Now(),
+	}
+	key := waitlistKey(locationID, date, slot)
+
+	if w.redis.IsConnected() {
+		raw, err := json.Marshal(entry)
+		if err != nil {
+			return WaitlistPosition{}, err
+		}
+		keys := []string{key, key + ":members", waitlistIndexKey, waitlistUserKey(userID)}
+		n, err := joinWaitlistScript.Run(ctx, w.redis.Client, keys,
+			userID, raw, waitlistRef(locationID, date, slot), int64(slotQuotaTTL.Seconds())).Int64()
+		if err != nil {
+			return WaitlistPosition{}, err
+		}
+		if n < 0 {
+			return WaitlistPosition{}, ErrWaitlistJoined
+		}
+		return WaitlistPosition{WaitlistEntry: entry, Position: n}, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	queue := w.queues[key]
+	if slices.ContainsFunc(queue, func(e models.WaitlistEntry) bool { return e.UserID == userID }) {
+		return WaitlistPosition{}, ErrWaitlistJoined
+	}
+	w.queues[key] = append(queue, entry)
+	return WaitlistPosition{WaitlistEntry: entry, Position: int64(len(w.queues[key]))}, nil
+}
+
+// Leave removes the user from the slot's waitlist. It reports false when
+// they were not on it.
+func (w *WaitlistService) Leave(userID, locationID, date, slot string) (bool, error) {
+	key := waitlistKey(locationID, date, slot)
+
+	if w.redis.IsConnected() {
+		entries, err := w.redis.Client.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return false, err
+		}
+		for _, raw := range entries {
+			var entry models.WaitlistEntry
+			if json.Unmarshal([]byte(raw), &entry) != nil || entry.UserID != userID {
+				continue
+			}
+			_, err := w.redis.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.LRem(ctx, key, 1, raw)
+				pipe.SRem(ctx, key+":members", userID)
+				pipe.SRem(ctx, waitlistUserKey(userID), waitlistRef(locationID, date, slot))
+				return nil
+			})
+			return err == nil, err
+		}
+		return false, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	queue := w.queues[key]
+	for i, entry := range queue {
+		if entry.UserID == userID {
+			w.queues[key] = slices.Delete(queue, i, i+1)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Entries lists the waitlists the user is on, with their positions.
+func (w *WaitlistService) Entries(userID string) ([]WaitlistPosition, error) {
+	var positions []WaitlistPosition
+
+	if w.redis.IsConnected() {
+		refs, err := w.redis.Client.SMembers(ctx, waitlistUserKey(userID)).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			locationID, date, slot := parseWaitlistRef(ref)
+			queue, err := w.queue(waitlistKey(locationID, date, slot))
+			if err != nil {
+				return nil, err
+			}
+			for i, entry := range queue {
+				if entry.UserID == userID {
+					positions = append(positions, WaitlistPosition{WaitlistEntry: entry, Position: int64(i + 1)})
+				}
+			}
+		}
+	} else {
+		w.mu.Lock()
+		for _, queue := range w.queues {
+			for i, entry := range queue {
+				if entry.UserID == userID {
+					positions = append(positions, WaitlistPosition{WaitlistEntry: entry, Position: int64(i + 1)})
+				}
+			}
+		}
+		w.mu.Unlock()
+	}
+
+	sort.Slice(positions, func(i, j int) bool { return positions[i].JoinedAt.Before(positions[j].JoinedAt) })
+	return positions, nil
+}
+
+// Offers lists the open claim offers of a user.
+func (w *WaitlistService) Offers(userID string) ([]models.WaitlistOffer, error) {
+	all, err := w.allOffers()
+	if err != nil {
+		return nil, err
+	}
+	var offers []models.WaitlistOffer
+	for _, offer := range all {
+		if offer.UserID == userID {
+			offers = append(offers, offer)
+		}
+	}
+	return offers, nil
+}
+
+// Released hands a seat that came free in a slot to the next waitlisted
+// user. The seat must still be taken from the counters; it only returns
+// to the public pool when nobody is waiting, so the waitlist gets first
+// claim. It reports whether someone got it.
+func (w *WaitlistService) Released(locationID, date, start string) bool {
+	w.handout.Lock()
+	defer w.handout.Unlock()
+
+	location, exists := w.store.GetLocation(locationID)
+	if !exists {
+		return false
+	}
+	slot, exists := location.Slot(start)
+	if !exists {
+		return false
+	}
+	if w.handOut(location, date, slot) {
+		return true
+	}
+	if err := w.redis.IncreaseSlotQuota(locationID, date, slot); err != nil {
+		log.Printf("waitlist seat return failed: %v", err)
+	}
+	return false
+}
+
+// LocationReleased offers up to seats freed location-wide (e.g. an
+// admin quota increase) to the location's waitlists, earliest date and
+// slot first.
+func (w *WaitlistService) LocationReleased(locationID string, seats int64) {
+	w.offerPooled(locationID, "", seats)
+}
+
+// SlotReleased offers up to seats added to a slot's capacity to the
+// slot's waitlist on every date, since capacity applies to each date
+// separately.
+func (w *WaitlistService) SlotReleased(locationID, start string, seats int64) {
+	w.offerPooled(locationID, start, seats)
+}
+
+// offerPooled hands seats that are already back in the public pool to
+// the location's waitlists, or only to those of slot start when it is
+// set. Location seats are shared by all its waitlists; slot seats are
+// offered on each date.
+func (w *WaitlistService) offerPooled(locationID, start string, seats int64) {
+	refs, err := w.refs()
+	if err != nil {
+		log.Printf("waitlist index read failed: %v", err)
+		return
+	}
+	today := time.Now().Format("2006-01-02")
+	sort.Strings(refs)
+	left := seats
+	for _, ref := range refs {
+		refLocation, date, slot := parseWaitlistRef(ref)
+		if refLocation != locationID || date < today || (start != "" && slot != start) {
+			continue
+		}
+		if start != "" {
+			left = seats
+		}
+		for left > 0 && w.fromPool(locationID, date, slot) {
+			left--
+		}
+	}
+}
+
+// fromPool takes a seat out of the public pool for the next waitlisted
+// user of a slot. It reports whether someone got it; if not, the seat
+// stays in the pool.
+func (w *WaitlistService) fromPool(locationID, date, start string) bool {
+	w.handout.Lock()
+	defer w.handout.Unlock()
+
+	key := waitlistKey(locationID, date, start)
+	if queue, err := w.queue(key); err != nil || len(queue) == 0 {
+		return false
+	}
+	location, exists := w.store.GetLocation(locationID)
+	if !exists {
+		return false
+	}
+	slot, exists := location.Slot(start)
+	if !exists {
+		return false
+	}
+
+	// Take the seat out of the pool before handing it over, so a public
+	// booking cannot grab it in between.
+	if _, _, err := w.redis.DecreaseSlotQuota(locationID, date, slot); err != nil {
+		return false
+	}
+	if !w.handOut(location, date, slot) {
+		if err := w.redis.IncreaseSlotQuota(locationID, date, slot); err != nil {
+			log.Printf("waitlist seat return failed: %v", err)
+		}
+		return false
+	}
+	return true
+}
+
+// Claim turns an offer into a ticket for its user.
+func (w *WaitlistService) Claim(offerID string, user models.User) (models.Ticket, error) {
+	offer, exists, err := w.getOffer(offerID)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	if !exists || offer.UserID != user.ID || time.Now().After(offer.ExpiresAt) {
+		return models.Ticket{}, ErrOfferNotFound
+	}
+	location, exists := w.store.GetLocation(offer.LocationID)
+	if !exists {
+		return models.Ticket{}, ErrNotFound
+	}
+	slot, exists := location.Slot(offer.TimeSlot)
+	if !exists {
+		return models.Ticket{}, ErrNotFound
+	}
+	day, err := time.Parse("2006-01-02", offer.Date)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+
+	if err := w.redis.AcquireHolding(user.NIK, location.ID, day, ReadHoldingLimits()); err != nil {
+		return models.Ticket{}, err
+	}
+	claimed, err := w.takeOffer(offer.ID)
+	if err != nil || !claimed {
+		w.redis.ReleaseHolding(user.NIK, location.ID, day)
+		if err == nil {
+			err = ErrOfferNotFound
+		}
+		return models.Ticket{}, err
+	}
+
+	ticket, err := NewTicket(w.redis, w.store, user, location, offer.Date, slot.Start)
+	if err == nil {
+		ticket.ID = offer.ID
+		err = w.store.SaveTicket(ticket)
+	}
+	if err != nil {
+		w.redis.ReleaseHolding(user.NIK, location.ID, day)
+		w.passOn(offer)
+		return models.Ticket{}, err
+	}
+	if _, err := w.redis.CommitReservation(offerReservation(offer, slot)); err != nil {
+		log.Printf("reservation %s commit failed: %v", offer.ID, err)
+	}
+	return ticket, nil
+}
+
+// Decline gives an offer up; the seat moves on to the next user.
+func (w *WaitlistService) Decline(offerID, userID string) error {
+	offer, exists, err := w.getOffer(offerID)
+	if err != nil {
+		return err
+	}
+	if !exists || offer.UserID != userID {
+		return ErrOfferNotFound
+	}
+	claimed, err := w.takeOffer(offer.ID)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrOfferNotFound
+	}
+	w.passOn(offer)
+	return nil
+}
+
+func (w *WaitlistService) expireOffers(now time.Time) {
+	offers, err := w.allOffers()
+	if err != nil {
+		log.Printf("waitlist offer sweep failed: %v", err)
+		return
+	}
+	for _, offer := range offers {
+		if now.Before(offer.ExpiresAt) {
+			continue
+		}
+		claimed, err := w.takeOffer(offer.ID)
+		if err != nil || !claimed {
+			continue
+		}
+		w.notify(NotifyWaitlistExpired, offer.UserID, "Penawaran kursi waitlist Anda sudah kedaluwarsa", offer)
+		w.passOn(offer)
+	}
+}
+
+// passOn moves the seat held by a taken offer to the next waiting user,
+// or back to the pool when nobody is left.
+func (w *WaitlistService) passOn(offer models.WaitlistOffer) {
+	w.handout.Lock()
+	defer w.handout.Unlock()
+
+	location, exists := w.store.GetLocation(offer.LocationID)
+	slot, slotExists := location.Slot(offer.TimeSlot)
+	reservation := offerReservation(offer, slot)
+	if !exists || !slotExists {
+		if err := w.redis.RollbackReservation(reservation); err != nil {
+			log.Printf("reservation %s rollback failed: %v", offer.ID, err)
+		}
+		return
+	}
+
+	// The seat stays taken; only the ledger entry changes hands.
+	if _, err := w.redis.CommitReservation(reservation); err != nil {
+		log.Printf("reservation %s commit failed: %v", offer.ID, err)
+	}
+	if !w.handOut(location, offer.Date, slot) {
+		if err := w.redis.IncreaseSlotQuota(location.ID, offer.Date, slot); err != nil {
+			log.Printf("waitlist seat return failed: %v", err)
+		}
+	}
+}
+
+// handOut gives a seat already taken from the counters to the first
+// waiting user it can. Callers must hold w.handout.
+func (w *WaitlistService) handOut(location models.Location, date string, slot models.TimeSlot) bool {
+	key := waitlistKey(location.ID, date, slot.Start)
+	for {
+		entry, ok, err := w.pop(key)
+		if err != nil {
+			log.Printf("waitlist pop failed: %v", err)
+			return false
+		}
+		if !ok {
+			return false
+		}
+		user, exists := w.store.GetUser(entry.UserID)
+		if !exists {
+			continue
+		}
+
+		if w.autoIssue {
+			err := w.issue(user, location, date, slot)
+			if err == nil {
+				return true
+			}
+			if errors.Is(err, ErrAlreadyBooked) {
+				// The NIK already holds a ticket that day; the seat goes
+				// to the next user.
+				continue
+			}
+			log.Printf("waitlist ticket for %s not issued: %v", user.ID, err)
+			w.pushFront(entry)
+			return false
+		}
+		if err := w.offer(entry, slot); err != nil {
+			log.Printf("waitlist offer failed: %v", err)
+			w.pushFront(entry)
+			return false
+		}
+		return true
+	}
+}
+
+// issue books the held seat for user directly. On error the seat is
+// kept; ErrAlreadyBooked means the NIK already holds a ticket that day.
+func (w *WaitlistService) issue(user models.User, location models.Location, date string, slot models.TimeSlot) error {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return err
+	}
+	if err := w.redis.AcquireHolding(user.NIK, location.ID, day, ReadHoldingLimits()); err != nil {
+		return err
+	}
+
+	ticket, err := NewTicket(w.redis, w.store, user, location, date, slot.Start)
+	if err == nil {
+		err = w.store.SaveTicket(ticket)
+	}
+	if err != nil {
+		w.redis.ReleaseHolding(user.NIK, location.ID, day)
+		return err
+	}
+	w.notify(NotifyWaitlistIssued, user.ID, "Tiket dari waitlist berhasil diterbitkan", ticket)
+	return nil
+}
+
+func (w *WaitlistService) offer(entry models.WaitlistEntry, slot models.TimeSlot) error {
+	id, err := randomHex(8)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	offer := models.WaitlistOffer{
+		ID:         id,
+		UserID:     entry.UserID,
+		LocationID: entry.LocationID,
+		Date:       entry.Date,
+		TimeSlot:   entry.TimeSlot,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(w.offerTTL),
+	}
+
+	reservation := offerReservation(offer, slot)
+	reservation.CreatedAt = now
+	if err := w.recordOfferReservation(reservation); err != nil {
+		return err
+	}
+	if err := w.putOffer(offer); err != nil {
+		w.redis.CommitReservation(reservation)
+		return err
+	}
+	w.notify(NotifyWaitlistOffer, offer.UserID, "Kursi tersedia untuk Anda, klaim sebelum batas waktu", offer)
+	return nil
+}
+
+// recordOfferReservation writes the ledger entry for a seat that is
+// already taken. Unlike Reserve it must not give the seat back on
+// failure, since the caller still holds it.
+func (w *WaitlistService) recordOfferReservation(r Reservation) error {
+	if w.redis.IsConnected() {
+		raw, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return w.redis.Client.HSet(ctx, reservationsKey, r.TicketID, raw).Err()
+	}
+	return w.redis.Reserve(r)
+}
+
+// notify delivers in the background: callers may hold w.handout, and a
+// slow webhook must not hold up other hand-outs.
+func (w *WaitlistService) notify(kind, userID, message string, data any) {
+	n := Notification{
+		Kind:    kind,
+		UserID:  userID,
+		Message: message,
+		Data:    data,
+		SentAt:  time.Now(),
+	}
+	w.sending.Add(1)
+	go func() {
+		defer w.sending.Done()
+		if err := w.notifier.Notify(n); err != nil {
+			log.Printf("notify %s for %s failed: %v", kind, userID, err)
+		}
+	}()
+}
+
+func (w *WaitlistService) queue(key string) ([]models.WaitlistEntry, error) {
+	if w.redis.IsConnected() {
+		raws, err := w.redis.Client.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		queue := make([]models.WaitlistEntry, 0, len(raws))
+		for _, raw := range raws {
+			var entry models.WaitlistEntry
+			if err := json.Unmarshal([]byte(raw), &entry); err == nil {
+				queue = append(queue, entry)
+			}
+		}
+		return queue, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.queues[key]), nil
+}
+
+func (w *WaitlistService) pop(key string) (models.WaitlistEntry, bool, error) {
+	if w.redis.IsConnected() {
+		raw, err := w.redis.Client.LPop(ctx, key).Result()
+		if err == redis.Nil {
+			return models.WaitlistEntry{}, false, nil
+		}
+		if err != nil {
+			return models.WaitlistEntry{}, false, err
+		}
+		var entry models.WaitlistEntry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			return models.WaitlistEntry{}, false, err
+		}
+		ref := waitlistRef(entry.LocationID, entry.Date, entry.TimeSlot)
+		w.redis.Client.SRem(ctx, key+":members", entry.UserID)
+		w.redis.Client.SRem(ctx, waitlistUserKey(entry.UserID), ref)
+		if n, err := w.redis.Client.LLen(ctx, key).Result(); err == nil && n == 0 {
+			w.redis.Client.SRem(ctx, waitlistIndexKey, ref)
+		}
+		return entry, true, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	queue := w.queues[key]
+	if len(queue) == 0 {
+		return models.WaitlistEntry{}, false, nil
+	}
+	w.queues[key] = queue[1:]
+	return queue[0], true, nil
+}
+
+// pushFront puts an entry back at the head of its waitlist.
+func (w *WaitlistService) pushFront(entry models.WaitlistEntry) {
+	key := waitlistKey(entry.LocationID, entry.Date, entry.TimeSlot)
+
+	if w.redis.IsConnected() {
+		raw, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		ref := waitlistRef(entry.LocationID, entry.Date, entry.TimeSlot)
+		_, err = w.redis.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.LPush(ctx, key, raw)
+			pipe.SAdd(ctx, key+":members", entry.UserID)
+			pipe.SAdd(ctx, waitlistUserKey(entry.UserID), ref)
+			pipe.SAdd(ctx, waitlistIndexKey, ref)
+			return nil
+		})
+		if err != nil {
+			log.Printf("waitlist requeue of %s failed: %v", entry.UserID, err)
+		}
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.queues[key] = append([]models.WaitlistEntry{entry}, w.queues[key]...)
+}
+
+// refs returns "location|date|slot" for every waitlist that has or had
+// entries.
+func (w *WaitlistService) refs() ([]string, error) {
+	if w.redis.IsConnected() {
+		return w.redis.Client.SMembers(ctx, waitlistIndexKey).Result()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	refs := make([]string, 0, len(w.queues))
+	for key, queue := range w.queues {
+		if len(queue) > 0 {
+			refs = append(refs, waitlistRef(queue[0].LocationID, queue[0].Date, queue[0].TimeSlot))
+		} else {
+			delete(w.queues, key)
+		}
+	}
+	return refs, nil
+}
+
+func (w *WaitlistService) putOffer(offer models.WaitlistOffer) error {
+	if w.redis.IsConnected() {
+		raw, err := json.Marshal(offer)
+		if err != nil {
+			return err
+		}
+		return w.redis.Client.HSet(ctx, waitlistOffersKey, offer.ID, raw).Err()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.offers[offer.ID] = offer
+	return nil
+}
+
+func (w *WaitlistService) getOffer(id string) (models.WaitlistOffer, bool, error) {
+	if w.redis.IsConnected() {
+		raw, err := w.redis.Client.HGet(ctx, waitlistOffersKey, id).Bytes()
+		if err == redis.Nil {
+			return models.WaitlistOffer{}, false, nil
+		}
+		if err != nil {
+			return models.WaitlistOffer{}, false, err
+		}
+		var offer models.WaitlistOffer
+		if err := json.Unmarshal(raw, &offer); err != nil {
+			return models.WaitlistOffer{}, false, err
+		}
+		return offer, true, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	offer, exists := w.offers[id]
+	return offer, exists, nil
+}
+
+// takeOffer removes an offer and reports whether this caller got it, so
+// a claim and an expiry cannot both act on the same offer.
+func (w *WaitlistService) takeOffer(id string) (bool, error) {
+	if w.redis.IsConnected() {
+		n, err := w.redis.Client.HDel(ctx, waitlistOffersKey, id).Result()
+		return n > 0, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, exists := w.offers[id]; !exists {
+		return false, nil
+	}
+	delete(w.offers, id)
+	return true, nil
+}
+
+func (w *WaitlistService) allOffers() ([]models.WaitlistOffer, error) {
+	if w.redis.IsConnected() {
+		entries, err := w.redis.Client.HGetAll(ctx, waitlistOffersKey).Result()
+		if err != nil {
+			return nil, err
+		}
+		offers := make([]models.WaitlistOffer, 0, len(entries))
+		for _, raw := range entries {
+			var offer models.WaitlistOffer
+			if err := json.Unmarshal([]byte(raw), &offer); err == nil {
+				offers = append(offers, offer)
+			}
+		}
+		return offers, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	offers := make([]models.WaitlistOffer, 0, len(w.offers))
+	for _, offer := range w.offers {
+		offers = append(offers, offer)
+	}
+	return offers, nil
+}
+
+func offerReservation(offer models.WaitlistOffer, slot models.TimeSlot) Reservation {
+	return Reservation{
+		TicketID:   offer.ID,
+		LocationID: offer.LocationID,
+		Date:       offer.Date,
+		Slot:       slot,
+		CreatedAt:  offer.CreatedAt,
+		ExpiresAt:  offer.ExpiresAt,
+	}
+}
+
+func waitlistKey(locationID, date, slot string) string {
+	return "waitlist:" + locationID + ":" + date + ":" + slot
+}
+
+func waitlistUserKey(userID string) string {
+	return "waitlist:user:" + userID
+}
+
+func waitlistRef(locationID, date, slot string) string {
+	return locationID + "|" + date + "|" + slot
+}
+
+func parseWaitlistRef(ref string) (string, string, string) {
+	parts := strings.SplitN(ref, "|", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	return parts[0], parts[1], parts[2]
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"testing"
+	"time"
+	"war-ticket-engine/models"
+)
+
+// blockingNotifier holds every notification until release is closed.
+type blockingNotifier struct {
+	sent    chan Notification
+	release chan struct{}
+}
+
+func (n blockingNotifier) Notify(notification Notification) error {
+	<-n.release
+	n.sent <- notification
+	return nil
+}
+
+func newTestWaitlist(t *testing.T, notifier Notifier) (*WaitlistService, *JSONStore, string) {
+	t.Helper()
+	db, _ := newTestJSONStore(t)
+	location := models.Location{
+		ID: "juanda", Name: "Juanda", Quota: 10, Enabled: true,
+		Slots: []models.TimeSlot{{Start: "09:00", End: "10:00", Capacity: 10}},
+	}
+	if _, err := db.AddLocation(location); err != nil {
+		t.Fatalf("AddLocation: %v", err)
+	}
+	if err := db.SetUser(testUser("u1", "1")); err != nil {
+		t.Fatalf("SetUser: %v", err)
+	}
+	redis := newTestRedis()
+	if err := redis.InitLocationQuota(location.ID, location.Quota); err != nil {
+		t.Fatalf("InitLocationQuota: %v", err)
+	}
+	w := NewWaitlistService(redis, db, notifier)
+	w.autoIssue = true
+	date := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	if _, err := w.Join("u1", location.ID, date, "09:00"); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	return w, db, date
+}
+
+func TestWaitlistAutoIssueRequeuesWhenIssuingFails(t *testing.T) {
+	w, db, date := newTestWaitlist(t, LogNotifier{})
+
+	// Every store write fails from here on.
+	db.wal.Close()
+
+	if w.Released("juanda", date, "09:00") {
+		t.Fatal("Released handed out a seat although the ticket was not stored")
+	}
+	entries, err := w.Entries("u1")
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Position != 1 {
+		t.Errorf("entries = %+v, want u1 back at position 1", entries)
+	}
+}
+
+func TestWaitlistNotifiesWithoutHoldingHandouts(t *testing.T) {
+	notifier := blockingNotifier{sent: make(chan Notification, 1), release: make(chan struct{})}
+	w, _, date := newTestWaitlist(t, notifier)
+
+	done := make(chan bool)
+	go func() { done <- w.Released("juanda", date, "09:00") }()
+	select {
+	case issued := <-done:
+		if !issued {
+			t.Fatal("Released did not issue the seat")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Released waited for the notification to be delivered")
+	}
+
+	close(notifier.release)
+	w.Stop()
+	select {
+	case n := <-notifier.sent:
+		if n.Kind != NotifyWaitlistIssued || n.UserID != "u1" {
+			t.Errorf("notification = %s for %s, want %s for u1", n.Kind, n.UserID, NotifyWaitlistIssued)
+		}
+	default:
+		t.Error("Stop returned before the notification was delivered")
+	}
+}
+
+func TestWaitlistGetsReleasedSeatsFirst(t *testing.T) {
+	tests := []struct {
+		name    string
+		waiting bool
+		release func(w *WaitlistService, date string) bool
+		// want is the slot's remaining seats after the release; the
+		// slot starts full.
+		want int64
+	}{
+		{"cancellation, user waiting", true, func(w *WaitlistService, date string) bool {
+			return w.Released("juanda", date, "09:00")
+		}, 0},
+		{"cancellation, nobody waiting", false, func(w *WaitlistService, date string) bool {
+			return w.Released("juanda", date, "09:00")
+		}, 1},
+		{"capacity raised, user waiting", true, func(w *WaitlistService, date string) bool {
+			w.redis.AdjustSlotQuota("juanda", date, "09:00", 1)
+			w.SlotReleased("juanda", "09:00", 1)
+			return true
+		}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, _, date := newTestWaitlist(t, LogNotifier{})
+			if !tt.waiting {
+				if _, err := w.Leave("u1", "juanda", date, "09:00"); err != nil {
+					t.Fatalf("Leave: %v", err)
+				}
+			}
+			location, _ := w.store.GetLocation("juanda")
+			slot, _ := location.Slot("09:00")
+			if err := w.redis.SetSlotQuota("juanda", date, slot, 0); err != nil {
+				t.Fatalf("SetSlotQuota: %v", err)
+			}
+
+			if got := tt.release(w, date); got != tt.waiting {
+				t.Errorf("seat handed out = %v, want %v", got, tt.waiting)
+			}
+			remaining, err := w.redis.GetSlotQuota("juanda", date, slot)
+			if err != nil {
+				t.Fatalf("GetSlotQuota: %v", err)
+			}
+			if remaining != tt.want {
+				t.Errorf("slot remaining = %d, want %d", remaining, tt.want)
+			}
+			if tt.waiting && len(w.store.ListTickets()) != 1 {
+				t.Errorf("%d tickets issued, want 1 for the waiting user", len(w.store.ListTickets()))
+			}
+			w.Stop()
+		})
+	}
+}
@@ -46,6 +46,16 @@ const readStoredUser = (): StoredUser | null => {
   }
 };
 
+const readAccessToken = (): string => {
+  if (typeof window === "undefined") return "";
+  try {
+    const session = JSON.parse(localStorage.getItem("session") || "null");
+    return typeof session?.access_token === "string" ? session.access_token : "";
+  } catch {
+    return "";
+  }
+};
+
 const MOCK_LOCATIONS: Location[] = [
   {
     id: "graha-dipta",
@@ -137,9 +147,11 @@ export default function AntreanPage() {
     try {
       const res = await fetch(`${API_BASE}/api/ticket`, {
         method: "POST",
-        headers: { "Content-Type": "application/json" },
+        headers: {
+          "Content-Type": "application/json",
+          Authorization: `Bearer ${readAccessToken()}`,
+        },
         body: JSON.stringify({
-          user_id: user.id,
           location_id: selectedLocation.id,
           time_slot: selectedTime,
         }),
@@ -158,7 +170,12 @@ export default function AntreanPage() {
   };
 
   const handleLogout = () => {
+    fetch(`${API_BASE}/api/logout`, {
+      method: "POST",
+      headers: { Authorization: `Bearer ${readAccessToken()}` },
+    }).catch(() => undefined);
     localStorage.removeItem("user");
+    localStorage.removeItem("session");
     router.push("/login");
   };
 
@@ -266,7 +283,7 @@ export default function AntreanPage() {
               >
                 <option value="">--Pilih Waktu Kedatangan--</option>
                 {TIME_SLOTS.map((slot, i) => (
-                  <option key={i} value={slot}>
+                  <option key={i} value={slot.slice(0, 5)}>
                     {slot}
                   </option>
                 ))}
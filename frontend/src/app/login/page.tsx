@@ -104,6 +104,7 @@ export default function LoginPage() {
       const data = await res.json();
       if (data.status === "success") {
         localStorage.setItem("user", JSON.stringify(data.user));
+        localStorage.setItem("session", JSON.stringify(data.session));
         router.push("/antrean");
       } else {
         setError(data.message || "Login gagal");
@@ -47,14 +47,37 @@ export default function Home() {
     setAppState('LOADING');
 
     try {
+      const authHeaders = {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${JSON.parse(localStorage.getItem('session') || '{}').access_token || ''}`,
+      };
+
+      // Join the waiting room and wait until our number is admitted
+      const joinRes = await fetch(`${API_BASE}/api/war/queue`, { method: 'POST', headers: authHeaders });
+      const joined = await joinRes.json();
+      if (joined.status !== 'success') {
+        setAppState('ERROR');
+        return;
+      }
+      let queue = joined.queue;
+      while (!queue.admitted) {
+        await new Promise((resolve) => setTimeout(resolve, 1000));
+        const statusRes = await fetch(`${API_BASE}/api/war/queue`, {
+          headers: { ...authHeaders, 'X-Queue-Token': queue.token },
+        });
+        const polled = await statusRes.json();
+        if (polled.status !== 'success') {
+          setAppState('ERROR');
+          return;
+        }
+        queue = polled.queue;
+      }
+
       // Real API call to Go backend
       const response = await fetch(`${API_BASE}/api/war`, {
         method: 'POST',
-        headers: {
-          'Content-Type': 'application/json',
-        },
+        headers: { ...authHeaders, 'X-Queue-Token': queue.token },
         body: JSON.stringify({
-          user_id: `user_${Date.now()}`,
           name: 'Test User'
         }),
       });